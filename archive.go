@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// The posts of one month, for the archive pages.
+type archiveMonth struct {
+	Year  int
+	Month time.Month
+	URL   string
+	Posts posts
+}
+
+// The posts of one year, also grouped by month.
+type archiveYear struct {
+	Year   int
+	URL    string
+	Months []archiveMonth
+	Posts  posts
+}
+
+func archiveYearPath(year int) string {
+	return "archive/" + strconv.Itoa(year) + ".html"
+}
+
+func archiveMonthPath(year int, month time.Month) string {
+	return fmt.Sprintf("archive/%d/%02d.html", year, month)
+}
+
+// Group posts by year and month, skipping static pages which don't have a
+// date. Expects posts to be sorted newest first, like Site.posts, and keeps
+// that order.
+func groupByDate(ps posts, baseURL string) []archiveYear {
+	years := make([]archiveYear, 0, 10)
+
+	for _, p := range ps {
+		if p.IsStatic() {
+			continue
+		}
+
+		year, month := p.Date.Year(), p.Date.Month()
+		if len(years) == 0 || years[len(years)-1].Year != year {
+			years = append(years, archiveYear{Year: year, URL: baseURL + archiveYearPath(year)})
+		}
+		y := &years[len(years)-1]
+		y.Posts = append(y.Posts, p)
+
+		if len(y.Months) == 0 || y.Months[len(y.Months)-1].Month != month {
+			y.Months = append(y.Months, archiveMonth{Year: year, Month: month, URL: baseURL + archiveMonthPath(year, month)})
+		}
+		m := &y.Months[len(y.Months)-1]
+		m.Posts = append(m.Posts, p)
+	}
+
+	return years
+}
+
+// Render archive.html with an overview of all years and months, and one page
+// per year and per month below archive/.
+func (s *Site) renderArchive(tp templateParam, engine templateEngine) error {
+	years := groupByDate(s.posts, s.conf.BaseURL)
+
+	tp.FeedId = "index"
+	tp.Feeds = s.feedLinks("index")
+	tp.FileId = "archive"
+	tp.PageTitle = "Archive"
+	err := s.renderArchivePage(tp, tp.PageTitle, years, nil, tp.FileId+".html", engine)
+	if err != nil {
+		return err
+	}
+
+	for _, y := range years {
+		tp.PageTitle = strconv.Itoa(y.Year)
+		err := s.renderArchivePage(tp, tp.PageTitle, []archiveYear{y}, y.Posts, archiveYearPath(y.Year), engine)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range y.Months {
+			tp.PageTitle = m.Month.String() + " " + strconv.Itoa(m.Year)
+			err := s.renderArchivePage(tp, tp.PageTitle, nil, m.Posts, archiveMonthPath(m.Year, m.Month), engine)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Site) renderArchivePage(tp templateParam, heading string, years []archiveYear, articles posts, relPath string, engine templateEngine) error {
+	var b bytes.Buffer
+	if err := engine.renderArchive(tp, heading, years, articles, &b); err != nil {
+		return err
+	}
+
+	outHtmlName := filepath.Join(s.conf.OutDir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(outHtmlName), 0o775); err != nil {
+		return err
+	}
+	return os.WriteFile(outHtmlName, b.Bytes(), 0o664)
+}
@@ -1,25 +1,274 @@
 package main
 
 import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+)
+
+// The Atom feed is modeled on github.com/thomas11/atomgenerator, which
+// derives both an entry's id and its <updated> element from the publication
+// date. We need them separately, so this is a small variant of it that also
+// writes <published>.
+
+// The feed formats of SiteConf.FeedFormats. All are made from the Atom feed,
+// see renderAndSaveFeed.
+const (
+	atomFormat     = "atom"
+	rssFormat      = "rss"
+	jsonFeedFormat = "json"
+)
 
-	atom "github.com/thomas11/atomgenerator"
+// The choices of SiteConf.FeedContent.
+const (
+	feedContentFull       = "full"
+	feedContentSummary    = "summary"
+	feedContentParagraphs = "paragraphs"
 )
 
-func (s *Site) RenderAtom() error {
-	filePath := filepath.Join(s.conf.OutDir, "index.xml")
-	err := s.renderAndSaveFeed(s.conf.SiteTitle, "", filePath, s.posts)
+// The file extension of each feed format.
+var feedExtensions = map[string]string{
+	atomFormat:     ".xml",
+	rssFormat:      ".rss",
+	jsonFeedFormat: ".json",
+}
+
+const atomNS = "http://www.w3.org/2005/Atom"
+
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+	URI   string `xml:"uri,omitempty"`
+}
+
+type atomCategory struct {
+	Term   string `xml:"term,attr"`
+	Scheme string `xml:"scheme,attr,omitempty"`
+	Label  string `xml:"label,attr,omitempty"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomText struct {
+	Body string `xml:",chardata"`
+	// "text" or "html".
+	Type string `xml:"type,attr"`
+}
+
+// The text as HTML.
+func (t *atomText) html() string {
+	if t.Type == "text" {
+		return html.EscapeString(t.Body)
+	}
+	return t.Body
+}
+
+type atomEntry struct {
+	XMLName    xml.Name       `xml:"entry"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published,omitempty"`
+	Updated    string         `xml:"updated"`
+	ID         string         `xml:"id"`
+	Summary    *atomText      `xml:"summary"`
+	Content    *atomText      `xml:"content"`
+	Authors    []atomPerson   `xml:"author"`
+	Categories []atomCategory `xml:"category,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"feed"`
+	NS      string       `xml:"xmlns,attr"`
+	Title   string       `xml:"title"`
+	Link    atomLink     `xml:"link"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Authors []atomPerson `xml:"author"`
+	Entries []*atomEntry
+}
+
+func atomDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// A tag URI as in RFC 4151, such as "tag:example.com,2024-01-31:/a.html".
+// The authority, a domain or email address, owned the tag at date, which
+// makes it globally unique.
+func tagURI(authority string, date time.Time, specific string) string {
+	return "tag:" + authority + "," + date.Format("2006-01-02") + ":" + specific
+}
+
+// Generate a unique global id for an entry using the scheme described in
+// http://web.archive.org/web/20110915110202/http://diveintomark.org/archives/2004/05/28/howto-atom-id,
+// the same as atomgenerator. Only used without SiteConf.TagAuthority, since
+// it changes with BaseURL.
+func atomEntryID(link string, published time.Time) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return tagURI(u.Host, published, u.Path)
+}
+
+// The permanent id of the feed at relBase, a path relative to OutDir without
+// the file extension. Without SiteConf.TagAuthority or TagDate, it's the URL
+// of the Atom feed.
+func (s *Site) feedID(relBase string) string {
+	if len(s.conf.TagAuthority) == 0 || len(s.conf.TagDate) == 0 {
+		return s.conf.BaseURL + relBase + feedExtensions[atomFormat]
+	}
+	return tagURI(s.conf.TagAuthority, s.tagDate(), "/"+relBase)
+}
+
+// The permanent id of a post's feed entry: its id header, or a tag URI of
+// its original date and ID.
+func (s *Site) entryID(p *post) string {
+	if len(p.FeedID) > 0 {
+		return p.FeedID
+	}
+	if len(s.conf.TagAuthority) == 0 {
+		return atomEntryID(s.conf.BaseURL+p.ID+".html", p.Date)
+	}
+	return tagURI(s.conf.TagAuthority, p.Date, "/"+p.ID+".html")
+}
+
+// SiteConf.TagDate, or the zero time if it's not set.
+func (s *Site) tagDate() time.Time {
+	t, _ := time.Parse(time.DateOnly, s.conf.TagDate)
+	return t
+}
+
+// Check whether the feed has everything Atom requires. Returns all problems
+// found.
+func (f *atomFeed) validate() []error {
+	errs := make([]error, 0, 5)
+
+	if len(f.Title) == 0 {
+		errs = append(errs, errors.New("feed must have a title"))
+	}
+	if len(f.Updated) == 0 {
+		errs = append(errs, errors.New("feed must have an updated date"))
+	}
+
+	// Either the feed has an author, or all entries must have one.
+	if len(f.Authors) == 0 {
+		for _, e := range f.Entries {
+			if len(e.Authors) == 0 {
+				errs = append(errs, fmt.Errorf("feed has no authors, and entry %v has none either", e.Title))
+			}
+		}
+	}
+	for i, author := range f.Authors {
+		if len(author.Name) == 0 {
+			errs = append(errs, fmt.Errorf("feed author %v must have a name", i))
+		}
+	}
+
+	for i, e := range f.Entries {
+		if len(e.Title) == 0 {
+			errs = append(errs, fmt.Errorf("entry %v must have a title", i))
+		}
+		if len(e.Updated) == 0 {
+			errs = append(errs, fmt.Errorf("entry %v must have an updated date", i))
+		}
+		for j, author := range e.Authors {
+			if len(author.Name) == 0 {
+				errs = append(errs, fmt.Errorf("author %v of entry %v must have a name", j, i))
+			}
+		}
+		for j, cat := range e.Categories {
+			if len(cat.Term) == 0 {
+				errs = append(errs, fmt.Errorf("category %v of entry %v must have a term", j, i))
+			}
+		}
+	}
+
+	return errs
+}
+
+func (f *atomFeed) genXML() ([]byte, error) {
+	data, err := xml.MarshalIndent(f, " ", " ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header[:len(xml.Header)-1]), data...), nil
+}
+
+// Write the feeds of the site, taxonomy terms, and authors in the formats of
+// SiteConf.FeedFormats.
+func (s *Site) RenderFeeds() error {
+	if len(s.conf.TagAuthority) == 0 {
+		log.Println("Warning: TagAuthority is not set, feed ids will change with BaseURL")
+	} else if len(s.conf.TagDate) == 0 {
+		log.Println("Warning: TagDate is not set, feed ids will change with BaseURL")
+	}
+
+	basePath := filepath.Join(s.conf.OutDir, "index")
+	err := s.renderAndSaveFeed(s.conf.SiteTitle, "", basePath, s.siteAuthors(), s.posts)
 	if err != nil {
 		return err
 	}
 
-	return s.renderAndSaveCategoriesAtom()
+	if err := s.renderAndSaveTaxonomyFeeds(); err != nil {
+		return err
+	}
+	return s.renderAndSaveAuthorFeeds()
 }
 
-func (s *Site) renderFeed(title, relURL string, articles []*post) ([]byte, error) {
+// A feed to link to from a page.
+type feedLink struct {
+	// "Atom", "RSS", or "JSON Feed".
+	Name string
+	// The MIME type, for <link rel="alternate" type="...">.
+	Type string
+	URL  string
+}
+
+// The feeds at relBase, a path relative to OutDir without the file
+// extension, in the formats of SiteConf.FeedFormats.
+func (s *Site) feedLinks(relBase string) []feedLink {
+	links := make([]feedLink, 0, len(s.conf.FeedFormats))
+	for _, format := range s.conf.FeedFormats {
+		l := feedLink{URL: s.conf.BaseURL + relBase + feedExtensions[format]}
+		switch format {
+		case atomFormat:
+			l.Name, l.Type = "Atom", "application/atom+xml"
+		case rssFormat:
+			l.Name, l.Type = "RSS", "application/rss+xml"
+		case jsonFeedFormat:
+			l.Name, l.Type = "JSON Feed", "application/feed+json"
+			if relBase == "index" {
+				l.URL = s.conf.BaseURL + jsonFeedIndexFile
+			}
+		}
+		links = append(links, l)
+	}
+	return links
+}
+
+// The global site author as feed author, if there is one.
+func (s *Site) siteAuthors() []atomPerson {
+	if len(s.conf.Author) == 0 {
+		return nil
+	}
+	return []atomPerson{{Name: s.conf.Author, URI: s.conf.AuthorURI}}
+}
+
+// The feed of articles as Atom, which the other feed formats are made from.
+func (s *Site) renderFeed(title, relURL, relBase string, authors []atomPerson, articles []*post) (*atomFeed, error) {
 	feedURL := s.conf.BaseURL
 	if len(relURL) > 0 {
 		if relURL[0] == '/' {
@@ -28,24 +277,36 @@ func (s *Site) renderFeed(title, relURL string, articles []*post) ([]byte, error
 		feedURL += relURL
 	}
 
-	feed := atom.Feed{
+	feed := atomFeed{
+		NS:      atomNS,
 		Title:   title,
-		Link:    feedURL,
-		PubDate: time.Now(),
+		Link:    atomLink{Href: feedURL, Rel: "alternate"},
+		ID:      s.feedID(relBase),
+		Authors: authors,
 	}
-	feed.AddAuthor(atom.Author{
-		Name: s.conf.Author,
-		Uri:  s.conf.AuthorURI,
-	})
 
+	// The feed was last updated with its newest change to a post, so that it
+	// stays the same between builds.
+	updated := s.tagDate()
 	for _, article := range articles {
-		if article.IsStatic() {
+		if !article.IsInFeeds() {
 			continue
 		}
-		feed.AddEntry(s.entryForArticle(article))
+		if s.conf.MaxFeedEntries > 0 && len(feed.Entries) >= s.conf.MaxFeedEntries {
+			break
+		}
+		feed.Entries = append(feed.Entries, s.entryForArticle(article))
+		if article.LastModified().After(updated) {
+			updated = article.LastModified()
+		}
+	}
+	if updated.IsZero() {
+		// A feed without entries and TagDate.
+		updated = lastModified(s.posts)
 	}
+	feed.Updated = atomDate(updated)
 
-	errs := feed.Validate()
+	errs := feed.validate()
 	if len(errs) > 0 {
 		log.Println("Atom feed is not valid!")
 		for _, e := range errs {
@@ -54,45 +315,138 @@ func (s *Site) renderFeed(title, relURL string, articles []*post) ([]byte, error
 		return nil, errs[0]
 	}
 
-	return feed.GenXml()
+	return &feed, nil
 }
 
-func (s *Site) entryForArticle(article *post) *atom.Entry {
-	e := &atom.Entry{
-		Title:       article.Title,
-		Description: article.Blurb,
-		Link:        s.conf.BaseURL + article.ID + ".html",
-		PubDate:     article.Date,
+func (s *Site) entryForArticle(article *post) *atomEntry {
+	link := s.conf.BaseURL + article.ID + ".html"
+	e := &atomEntry{
+		Title:     article.Title,
+		Link:      atomLink{Href: link, Rel: "alternate"},
+		ID:        s.entryID(article),
+		Published: atomDate(article.Date),
+		Updated:   atomDate(article.LastModified()),
+	}
+
+	if len(article.Blurb) > 0 {
+		// Blurbs are plain text, the first paragraph used without one is
+		// HTML.
+		e.Summary = &atomText{article.Blurb, "text"}
+	}
+
+	for _, a := range s.authorsOf(article) {
+		e.Authors = append(e.Authors, a.atomPerson())
 	}
 
-	for _, cat := range article.Categories {
-		e.AddCategory(atom.Category{Term: string(cat)})
+	for _, cat := range article.Categories() {
+		e.Categories = append(e.Categories, atomCategory{Term: string(cat)})
 	}
 
-	if renderedBody, ok := s.renderCache[article.ID]; ok {
-		e.Content = renderedBody
+	renderedBody, ok := s.renderCache[article.ID]
+	switch {
+	case !ok:
+	case s.conf.FeedContent == feedContentSummary:
+		if e.Summary == nil {
+			summary := firstParagraph(renderedBody)
+			if len(summary) == 0 {
+				summary = html.EscapeString(article.Title)
+			}
+			e.Summary = &atomText{summary, "html"}
+		}
+	case s.conf.FeedContent == feedContentParagraphs:
+		content := firstParagraphs(renderedBody, s.conf.FeedParagraphs)
+		if len(content) < len(renderedBody) {
+			content += fmt.Sprintf("\n<p><a href=\"%s\">Read more…</a></p>\n", html.EscapeString(link))
+		}
+		e.Content = &atomText{content, "html"}
+	default:
+		e.Content = &atomText{renderedBody, "html"}
 	}
 
 	return e
 }
 
-func (s *Site) renderAndSaveFeed(title, relURL, filePath string, articles []*post) error {
-	atomXML, err := s.renderFeed(title, relURL, articles)
+// The first <p> element of body, or "" if there is none.
+func firstParagraph(body string) string {
+	start := strings.Index(body, "<p>")
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(body[start:], "</p>")
+	if end < 0 {
+		return ""
+	}
+	return body[start : start+end+len("</p>")]
+}
+
+// The beginning of body up to the end of its nth paragraph, or all of body if
+// it has fewer.
+func firstParagraphs(body string, n int) string {
+	end := 0
+	for i := 0; i < n; i++ {
+		j := strings.Index(body[end:], "</p>")
+		if j < 0 {
+			return body
+		}
+		end += j + len("</p>")
+	}
+	return body[:end]
+}
+
+// Write the feed in each format of SiteConf.FeedFormats, to basePath with
+// the format's file extension.
+func (s *Site) renderAndSaveFeed(title, relURL, basePath string, authors []atomPerson, articles []*post) error {
+	relBase, err := filepath.Rel(s.conf.OutDir, basePath)
+	if err != nil {
+		return err
+	}
+	feed, err := s.renderFeed(title, relURL, filepath.ToSlash(relBase), authors, articles)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(filePath, atomXML, 0o664)
+	for _, format := range s.conf.FeedFormats {
+		filePath := basePath + feedExtensions[format]
+		if format == jsonFeedFormat && basePath == filepath.Join(s.conf.OutDir, "index") {
+			filePath = filepath.Join(s.conf.OutDir, jsonFeedIndexFile)
+		}
+
+		var data []byte
+		switch format {
+		case atomFormat:
+			data, err = feed.genXML()
+		case rssFormat:
+			data, err = rssFromAtom(feed).genXML()
+		case jsonFeedFormat:
+			data, err = jsonFeedFromAtom(feed, s.fileURL(filePath)).genJSON()
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filePath, data, 0o664); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The URL of a file in OutDir.
+func (s *Site) fileURL(filePath string) string {
+	rel, err := filepath.Rel(s.conf.OutDir, filePath)
+	if err != nil {
+		return s.conf.BaseURL
+	}
+	return s.conf.BaseURL + filepath.ToSlash(rel)
 }
 
-func (s *Site) renderAndSaveCategoriesAtom() error {
-	for _, catArticles := range groupByCategory(s.posts) {
-		category := catArticles.Category
-		title := s.conf.SiteTitle + ` Category "` + category.String() + `."`
-		urlPath := s.conf.CategoriesOutDir + "/" + category.Id() + "/"
-		filePath := filepath.Join(s.conf.OutDir, s.conf.CategoriesOutDir, category.Id()+".xml")
+func (s *Site) renderAndSaveAuthorFeeds() error {
+	for _, authorArticles := range s.groupByAuthor(s.posts) {
+		author := authorArticles.Author
+		title := s.conf.SiteTitle + ` Author "` + author.Name + `."`
+		urlPath := s.conf.AuthorsOutDir + "/" + author.Id() + ".html"
+		basePath := filepath.Join(s.conf.OutDir, s.conf.AuthorsOutDir, author.Id())
 
-		err := s.renderAndSaveFeed(title, urlPath, filePath, catArticles.Posts)
+		err := s.renderAndSaveFeed(title, urlPath, basePath, []atomPerson{author.atomPerson()}, authorArticles.Posts)
 		if err != nil {
 			return err
 		}
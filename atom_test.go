@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeedIDs(t *testing.T) {
+	date := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	p := &post{ID: "a-post", Date: date}
+
+	// With TagAuthority, ids don't depend on BaseURL.
+	for _, baseURL := range []string{"https://example.com/", "https://example.com/blog/", "https://example.org/"} {
+		s := &Site{conf: &SiteConf{BaseURL: baseURL, TagAuthority: "example.com", TagDate: "2020-01-01"}}
+		if got, want := s.feedID("categories/go"), "tag:example.com,2020-01-01:/categories/go"; got != want {
+			t.Errorf("%v: feed id %v, want %v", baseURL, got, want)
+		}
+		if got, want := s.entryID(p), "tag:example.com,2024-01-31:/a-post.html"; got != want {
+			t.Errorf("%v: entry id %v, want %v", baseURL, got, want)
+		}
+	}
+
+	// Without, they are derived from URLs as before.
+	s := &Site{conf: &SiteConf{BaseURL: "https://example.com/blog/"}}
+	if got, want := s.feedID("index"), "https://example.com/blog/index.xml"; got != want {
+		t.Errorf("feed id without TagAuthority %v, want %v", got, want)
+	}
+	if got, want := s.entryID(p), "tag:example.com,2024-01-31:/blog/a-post.html"; got != want {
+		t.Errorf("entry id without TagAuthority %v, want %v", got, want)
+	}
+
+	if got := s.entryID(&post{ID: "a-post", Date: date, FeedID: "urn:x"}); got != "urn:x" {
+		t.Errorf("entry id %v, want the id header urn:x", got)
+	}
+}
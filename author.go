@@ -0,0 +1,87 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+type AuthorConf struct {
+	Name, URI, Email string
+	Bio              string
+}
+
+// An author of posts. Authors that are not configured in SiteConf.Authors
+// only have a Name, which is the Key from the post header.
+type author struct {
+	AuthorConf
+	Key string
+	// The author's listing page.
+	URL string
+}
+
+func (a author) Id() string { return strings.ReplaceAll(a.Key, " ", "_") }
+
+func (a author) atomPerson() atomPerson {
+	return atomPerson{Name: a.Name, Email: a.Email, URI: a.URI}
+}
+
+type authorWithPosts struct {
+	Author author
+	Posts  posts
+}
+
+func (s *Site) author(key string) author {
+	a := author{AuthorConf: s.conf.Authors[key], Key: key}
+	if len(a.Name) == 0 {
+		a.Name = key
+	}
+	a.URL = s.conf.BaseURL + s.conf.AuthorsOutDir + "/" + a.Id() + ".html"
+	return a
+}
+
+func (s *Site) authorsOf(p *post) []author {
+	authors := make([]author, 0, len(p.Authors))
+	for _, key := range p.Authors {
+		authors = append(authors, s.author(key))
+	}
+	return authors
+}
+
+// Group posts by the authors named in their headers, ordered by author name.
+// Posts without an author header are left out.
+func (s *Site) groupByAuthor(ps posts) []authorWithPosts {
+	byAuthor := make([]authorWithPosts, 0, len(s.conf.Authors))
+
+	for _, p := range ps {
+		for _, key := range p.Authors {
+			i := slices.IndexFunc(byAuthor, func(a authorWithPosts) bool { return a.Author.Key == key })
+			if i == -1 {
+				byAuthor = append(byAuthor, authorWithPosts{Author: s.author(key)})
+				i = len(byAuthor) - 1
+			}
+			byAuthor[i].Posts = append(byAuthor[i].Posts, p)
+		}
+	}
+
+	slices.SortFunc(byAuthor, func(a, b authorWithPosts) int {
+		return strings.Compare(a.Author.Name, b.Author.Name)
+	})
+	return byAuthor
+}
+
+// Render a paginated list of posts for each author under AuthorsOutDir.
+func (s *Site) renderAuthorPages(tp templateParam, engine templateEngine) error {
+	for _, a := range s.groupByAuthor(s.posts) {
+		id := a.Author.Id()
+		tp.PageTitle = a.Author.Name
+		tp.FeedId = id
+		tp.Feeds = s.feedLinks(s.conf.AuthorsOutDir + "/" + id)
+		tp.FileId = id
+		p := postListTemplateParam{templateParam: tp, PageHeading: a.Author.Name, Author: &a.Author}
+		dir := s.conf.AuthorsOutDir + "/" + id
+		if err := s.renderPaginatedPostsList(a.Posts, dir+".html", dir, p, engine); err != nil {
+			return err
+		}
+	}
+	return nil
+}
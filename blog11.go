@@ -3,9 +3,10 @@ package main
 import (
 	"flag"
 	"log"
-	"net/http"
+	"os"
 	"time"
 
+	"github.com/otiai10/copy"
 	"github.com/radovskyb/watcher"
 )
 
@@ -13,61 +14,149 @@ var siteConfPath = flag.String("siteConfPath", "blog11.json", "Path to the site
 var serve = flag.Bool("serve", false, "Start a localhost:9999 server for the site")
 var watch = flag.Bool("watch", false, "Keep running and re-render the site on changes to the input directory.")
 var drafts = flag.Bool("drafts", false, "Include articles with the 'draft' flag.")
+var future = flag.Bool("future", false, "Include articles dated in the future.")
 
 func main() {
 	flag.Parse()
 
+	// Exporting the theme to a given directory works without a site.
+	if flag.Arg(0) == "theme" {
+		exportThemeCommand()
+		return
+	}
+
 	conf := readConf(*siteConfPath)
 
-	renderSite(conf, *drafts)
+	// Commands other than rendering the site.
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+	case "highlight-css":
+		if err := writeHighlightCSS(conf); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "compare-markdown":
+		site, err := ReadSite(conf, *drafts, *future)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := site.CompareMarkdownEngines(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	default:
+		log.Fatalf("Unknown command %q", cmd)
+	}
+
+	if !*watch && !*serve {
+		if _, err := renderSite(conf, *drafts, *future); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Keep running on errors, showing them on the served pages.
+	status := &buildStatus{}
+	nextScheduled := renderSiteStaged(conf, *drafts, *future, status)
 
 	if *watch && *serve {
 		// Run watcher in background while serving
-		go rerenderOnChange(conf, *drafts)
+		go rerenderOnChange(conf, *drafts, *future, nextScheduled, status)
 	}
 
 	if *serve {
-		serveSite(conf.OutDir)
+		serveSite(conf.OutDir, status)
 	} else if *watch {
 		// Watch mode without serve: block on the watcher
-		rerenderOnChange(conf, *drafts)
+		rerenderOnChange(conf, *drafts, *future, nextScheduled, status)
 	}
 }
 
-func renderSite(conf *SiteConf, drafts bool) {
-	site, err := ReadSite(conf, drafts)
-	if err != nil {
+// "theme export [dir]": copy the built-in theme to dir, by default the
+// TemplateDir of the site.
+func exportThemeCommand() {
+	if flag.Arg(1) != "export" {
+		log.Fatalf("Unknown theme command %q, try \"theme export [dir]\"", flag.Arg(1))
+	}
+	dir := flag.Arg(2)
+	if len(dir) == 0 {
+		dir = readConf(*siteConfPath).TemplateDir
+	}
+	if err := exportTheme(dir); err != nil {
 		log.Fatal(err)
 	}
+}
+
+// Render the site. Returns the date of the next post that was left out
+// because it's scheduled for the future, or the zero time.
+func renderSite(conf *SiteConf, drafts, future bool) (time.Time, error) {
+	site, err := ReadSite(conf, drafts, future)
+	if err != nil {
+		return time.Time{}, err
+	}
 
 	log.Println("Writing site to " + conf.OutDir)
 	if err = site.RenderAll(); err != nil {
-		log.Fatal(err)
-	}
-	if err = site.CopyStaticFiles(); err != nil {
-		log.Fatal(err)
+		return site.nextScheduled, err
 	}
+	return site.nextScheduled, site.CopyStaticFiles()
 }
 
-func serveSite(dir string) {
-	port := ":9999"
+// Render the site to a temporary directory and copy it to OutDir only if
+// that succeeds, so that errors leave the last good output in place. The
+// outcome is recorded in status.
+func renderSiteStaged(conf *SiteConf, drafts, future bool, status *buildStatus) time.Time {
+	nextScheduled, err := func() (time.Time, error) {
+		staging, err := os.MkdirTemp("", "blog11-")
+		if err != nil {
+			return time.Time{}, err
+		}
+		defer os.RemoveAll(staging)
 
-	http.Handle("/", http.FileServer(http.Dir(dir)))
-	log.Printf("Serving %v on %v.", dir, port)
-	log.Fatal(http.ListenAndServe(port, nil))
+		stagingConf := *conf
+		stagingConf.OutDir = staging
+		nextScheduled, err := renderSite(&stagingConf, drafts, future)
+		if err != nil {
+			return nextScheduled, err
+		}
+		log.Println("Copying site to " + conf.OutDir)
+		return nextScheduled, copy.Copy(staging, conf.OutDir)
+	}()
+	if err != nil {
+		log.Println("Error rendering site, keeping the last output:", err)
+	}
+	status.set(err)
+	return nextScheduled
 }
 
-func rerenderOnChange(siteConf *SiteConf, drafts bool) {
+// Returns a channel that receives when t has come, or nil, which blocks
+// forever, if t is zero.
+func scheduledAt(t time.Time) <-chan time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	log.Println("Next scheduled post is due at", t)
+	return time.After(time.Until(t))
+}
+
+// Re-render the site on changes to the writing or template directory, and
+// when the post scheduled for nextScheduled comes due. The outcome of each
+// render goes to status.
+func rerenderOnChange(siteConf *SiteConf, drafts, future bool, nextScheduled time.Time, status *buildStatus) {
 	log.Println("Watching " + siteConf.WritingDir + " for changes...")
 
 	watcher := watcher.New()
 	watcher.SetMaxEvents(1)
 
 	go func() {
+		due := scheduledAt(nextScheduled)
 		for {
 			select {
 			case <-watcher.Event:
-				renderSite(siteConf, drafts)
+				due = scheduledAt(renderSiteStaged(siteConf, drafts, future, status))
+			case <-due:
+				log.Println("Publishing scheduled post")
+				due = scheduledAt(renderSiteStaged(siteConf, drafts, future, status))
 			case err := <-watcher.Error:
 				log.Println(err)
 			case <-watcher.Closed:
@@ -79,6 +168,12 @@ func rerenderOnChange(siteConf *SiteConf, drafts bool) {
 	if err := watcher.AddRecursive(siteConf.WritingDir); err != nil {
 		log.Fatalln(err)
 	}
+	// Pick up fixes to broken templates, too.
+	if _, err := os.Stat(siteConf.TemplateDir); err == nil {
+		if err := watcher.AddRecursive(siteConf.TemplateDir); err != nil {
+			log.Fatalln(err)
+		}
+	}
 
 	if err := watcher.Start(time.Millisecond * 200); err != nil {
 		log.Fatalln(err)
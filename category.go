@@ -7,6 +7,8 @@ import (
 	"strings"
 )
 
+// A term of a taxonomy. Categories used to be the only taxonomy, hence the
+// name.
 type category string
 
 func (c category) String() string { return string(c) }
@@ -26,8 +28,8 @@ func (c categoryWithPosts) LatestDateFormatted() string {
 	return formatDateShort(c.Posts.latestDate())
 }
 
-// Posts grouped by category. Sort sorts by number of articles per category, then by newest article.
-// Create using the groupByCategory methods which sorts like this.
+// Posts grouped by the terms of a taxonomy, sorted by number of articles per
+// term, then by newest article. Create using groupByTerm, which sorts like this.
 type postsByCategory []categoryWithPosts
 
 func (pc *postsByCategory) addPost(c category, a *post) {
@@ -73,16 +75,16 @@ func (pc postsByCategory) frequentCategories(n, minPosts int) []category {
 	return frequent
 }
 
-func groupByCategory(posts posts) postsByCategory {
+func groupByTerm(posts posts, taxonomy string) postsByCategory {
 	byCat := make(postsByCategory, 0, 20)
 
 	for _, post := range posts {
-		for _, cat := range post.Categories {
+		for _, cat := range post.Terms[taxonomy] {
 			byCat.addPost(cat, post)
 		}
 	}
 
-	// Order categories by the number of articles in them, then by newest article.
+	// Order terms by the number of articles in them, then by newest article.
 	slices.SortFunc(byCat, func(a, b categoryWithPosts) int {
 		// More posts = comes first (descending order)
 		if c := cmp.Compare(len(b.Posts), len(a.Posts)); c != 0 {
@@ -94,3 +96,24 @@ func groupByCategory(posts posts) postsByCategory {
 
 	return byCat
 }
+
+// Find p's older and newer neighbour posts in each of its categories.
+// Categories where p has no such neighbour are left out of the maps.
+func neighboursInCategories(byCat postsByCategory, p *post) (prev, next map[category]*post) {
+	prev = make(map[category]*post)
+	next = make(map[category]*post)
+
+	for _, c := range byCat {
+		if !slices.Contains(p.Categories(), c.Category) {
+			continue
+		}
+		older, newer := c.Posts.neighbours(p)
+		if older != nil {
+			prev[c.Category] = older
+		}
+		if newer != nil {
+			next[c.Category] = newer
+		}
+	}
+	return prev, next
+}
@@ -4,7 +4,8 @@
 // To get started, copy example/exampleconf.go and customize it for
 // your setup. Run something like example/build.sh to build your site.
 //
-// You need to provide your own templates.
+// A default theme is built in; templates in TemplateDir override it file by
+// file. Run "blog11 theme export" to get a copy to customize.
 //
 // Thomas Kappler <http://www.thomaskappler.net/>
 //
@@ -16,8 +17,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/otiai10/copy"
@@ -27,6 +30,9 @@ type Site struct {
 	posts       posts
 	conf        *SiteConf
 	renderCache map[string]string
+	// The date of the earliest post left out because it's in the future.
+	// Zero if there is none.
+	nextScheduled time.Time
 }
 
 func extractDateFromFilename(filename string, dateStampFormat string) (*time.Time, error) {
@@ -42,21 +48,71 @@ func extractDateFromFilename(filename string, dateStampFormat string) (*time.Tim
 	return &date, nil
 }
 
-func renderPostsListToFile(articles []*post, path string, tp templateParam, showTopicsLink bool, category category, engine templateEngine) (err error) {
-	outFile, err := os.Create(path)
-	if err != nil {
+func renderPostsListToFile(p postListTemplateParam, path string, engine templateEngine) error {
+	var b bytes.Buffer
+	if err := engine.renderPostList(p, &b); err != nil {
 		return err
 	}
-	defer func() {
-		if cerr := outFile.Close(); cerr != nil && err == nil {
-			err = cerr
+	return os.WriteFile(path, b.Bytes(), 0o664)
+}
+
+// Split articles into pages of at most perPage posts. If perPage is not
+// positive, all articles go on a single page. There is always at least one
+// page, even if it is empty.
+func paginate(articles posts, perPage int) []posts {
+	if perPage <= 0 || len(articles) <= perPage {
+		return []posts{articles}
+	}
+
+	pages := make([]posts, 0, (len(articles)+perPage-1)/perPage)
+	for len(articles) > perPage {
+		pages = append(pages, articles[:perPage])
+		articles = articles[perPage:]
+	}
+	return append(pages, articles)
+}
+
+// Returns the output file and the URL of page n of a post listing. The first
+// page lives at firstPage, all others at pagesDir/page/<n>.html. Both paths
+// are slash-separated and relative to OutDir.
+func (s *Site) pageLocation(firstPage, pagesDir string, n int) (file, url string) {
+	rel := firstPage
+	if n > 1 {
+		rel = path.Join(pagesDir, "page", strconv.Itoa(n)+".html")
+	}
+	return filepath.Join(s.conf.OutDir, filepath.FromSlash(rel)), s.conf.BaseURL + rel
+}
+
+// Render articles as a list, split into pages of PostsPerPage posts. The
+// Posts and page fields of p are set for each page.
+func (s *Site) renderPaginatedPostsList(articles posts, firstPage, pagesDir string, p postListTemplateParam, engine templateEngine) error {
+	pages := paginate(articles, s.conf.PostsPerPage)
+	for i, pagePosts := range pages {
+		n := i + 1
+		p.Posts = pagePosts
+		p.pageInfo = pageInfo{PageNum: n, TotalPages: len(pages)}
+		if n > 1 {
+			_, p.PrevPageURL = s.pageLocation(firstPage, pagesDir, n-1)
+		}
+		if n < len(pages) {
+			_, p.NextPageURL = s.pageLocation(firstPage, pagesDir, n+1)
 		}
-	}()
 
-	return engine.renderPostList(tp, articles, showTopicsLink, category.String(), outFile)
+		outHtmlName, _ := s.pageLocation(firstPage, pagesDir, n)
+		if err := os.MkdirAll(filepath.Dir(outHtmlName), 0o775); err != nil {
+			return err
+		}
+		err := renderPostsListToFile(p, outHtmlName, engine)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func ReadSite(conf *SiteConf, drafts bool) (*Site, error) {
+// Read all posts. Drafts and posts dated in the future are only included if
+// drafts or future, respectively, are true.
+func ReadSite(conf *SiteConf, drafts, future bool) (*Site, error) {
 	files, err := findPostFiles(conf.WritingDir, conf.WritingFileExtension)
 	if err != nil {
 		return nil, err
@@ -68,14 +124,22 @@ func ReadSite(conf *SiteConf, drafts bool) (*Site, error) {
 		renderCache: make(map[string]string),
 	}
 
+	now := time.Now()
 	for _, f := range files {
-		a, err := readPostFromFile(f, conf.WritingFileDateStampFormat)
+		a, err := readPostFromFile(f, conf)
 		if err != nil {
 			return nil, err
 		}
-		if drafts || !a.IsDraft() {
-			thisSite.posts = append(thisSite.posts, a)
+		if !drafts && a.IsDraft() {
+			continue
+		}
+		if !future && a.Date.After(now) {
+			if thisSite.nextScheduled.IsZero() || a.Date.Before(thisSite.nextScheduled) {
+				thisSite.nextScheduled = a.Date
+			}
+			continue
 		}
+		thisSite.posts = append(thisSite.posts, a)
 	}
 
 	// Order articles by date.
@@ -85,7 +149,15 @@ func ReadSite(conf *SiteConf, drafts bool) (*Site, error) {
 }
 
 func (s *Site) RenderHtml() error {
-	engine := newTemplateEngine(newMarkdownRenderer(), s.conf.TemplateDir)
+	h, err := newHighlighter(s.conf)
+	if err != nil {
+		return err
+	}
+	renderers, err := newMarkdownRenderers(s.conf, h)
+	if err != nil {
+		return err
+	}
+	engine := newTemplateEngine(renderers, s.conf)
 
 	// Create a global template parameter holder. We'll re-use it for all
 	// pages, overwriting the title.
@@ -98,11 +170,24 @@ func (s *Site) RenderHtml() error {
 	postsRecentEnoughForFrequentCategories := s.posts.pruneOlderThan(minPostDate)
 	log.Println(len(s.posts), minPostDate, len(postsRecentEnoughForFrequentCategories))
 	globalTP := templateParam{
-		FrequentCategories: groupByCategory(postsRecentEnoughForFrequentCategories).frequentCategories(
+		SiteTitle:     s.conf.SiteTitle,
+		BaseURL:       s.conf.BaseURL,
+		categoriesDir: s.conf.CategoriesOutDir,
+		FrequentCategories: groupByTerm(postsRecentEnoughForFrequentCategories, "categories").frequentCategories(
 			s.conf.NumFrequentCategories,
 			s.conf.MinArticlesForFrequentCategories),
 	}
 	log.Println(globalTP.FrequentCategories)
+	if !s.conf.HighlightInlineStyles {
+		globalTP.HighlightCSSURL = s.conf.BaseURL + highlightCSSFile
+	}
+	if t := s.conf.taxonomy("categories"); t != nil {
+		globalTP.categoriesDir = t.OutDir
+	}
+
+	allSeries := s.groupBySeries(s.posts)
+	byCategory := groupByTerm(s.posts, "categories")
+	related := s.relatedPosts()
 
 	// Render the articles.
 	for _, a := range s.posts {
@@ -110,8 +195,18 @@ func (s *Site) RenderHtml() error {
 		var b bytes.Buffer
 		globalTP.PageTitle = a.Title
 		globalTP.FeedId = "index"
+		globalTP.Feeds = s.feedLinks("index")
 		globalTP.FileId = a.ID
-		renderedBody, err := engine.renderPost(globalTP, a, &b)
+		p := postTemplateParam{
+			templateParam: globalTP,
+			post:          a,
+			PostAuthors:   s.authorsOf(a),
+			SeriesNav:     navInSeries(allSeries, a),
+			RelatedPosts:  related[a],
+		}
+		p.PrevPost, p.NextPost = s.posts.neighbours(a)
+		p.PrevInCategory, p.NextInCategory = neighboursInCategories(byCategory, a)
+		renderedBody, err := engine.renderPost(p, &b)
 		if err != nil {
 			return err
 		}
@@ -122,54 +217,44 @@ func (s *Site) RenderHtml() error {
 		s.renderCache[a.ID] = renderedBody
 	}
 
-	// Render the category pages.
-	byCat := groupByCategory(s.posts)
-
-	catDir := filepath.Join(s.conf.OutDir, s.conf.CategoriesOutDir)
-	if _, err := os.Stat(catDir); os.IsNotExist(err) {
-		err2 := os.Mkdir(catDir, 0o775)
-		if err2 != nil {
-			log.Printf("Error creating directory %v: %v", catDir, err2)
+	// Render the pages of all taxonomies, such as categories.
+	for i := range s.conf.Taxonomies {
+		if err := s.renderTaxonomyPages(&s.conf.Taxonomies[i], globalTP, engine); err != nil {
+			return err
 		}
 	}
 
-	for _, c := range byCat {
-		catId := c.Category.Id()
-		outHtmlName := filepath.Join(catDir, catId+".html")
-		globalTP.PageTitle = c.Category.String()
-		globalTP.FeedId = catId
-		globalTP.FileId = catId
-		err := renderPostsListToFile(c.Posts, outHtmlName, globalTP, false, c.Category, engine)
-		if err != nil {
-			return err
-		}
+	// Render the series index pages.
+	if err := s.renderSeriesPages(allSeries, globalTP, engine); err != nil {
+		return err
 	}
 
-	// Render the topics/categories overview page.
-	var b bytes.Buffer
-	globalTP.PageTitle = "Topics"
-	globalTP.FeedId = "index"
-	globalTP.FileId = "topics"
-	err := engine.renderTopics(globalTP, byCat, &b)
-	if err != nil {
+	// Render the author pages.
+	if err := s.renderAuthorPages(globalTP, engine); err != nil {
 		return err
 	}
-	outHtmlName := filepath.Join(s.conf.OutDir, globalTP.FileId+".html")
-	if err := os.WriteFile(outHtmlName, b.Bytes(), 0o664); err != nil {
+
+	// Render the chronological archive.
+	if err := s.renderArchive(globalTP, engine); err != nil {
 		return err
 	}
 
-	// Render index.html with the last MaxArticlesOnIndex articles.
+	// Render index.html. Without pagination, it shows the last
+	// MaxArticlesOnIndex articles and links to the topics page for the rest.
 	articlesForIndex := s.posts
-	haveMoreArticles := len(s.posts) > s.conf.MaxArticlesOnIndex
-	if haveMoreArticles {
-		articlesForIndex = articlesForIndex[:s.conf.MaxArticlesOnIndex]
+	haveMoreArticles := false
+	if s.conf.PostsPerPage <= 0 {
+		haveMoreArticles = len(s.posts) > s.conf.MaxArticlesOnIndex
+		if haveMoreArticles {
+			articlesForIndex = articlesForIndex[:s.conf.MaxArticlesOnIndex]
+		}
 	}
 	globalTP.PageTitle = s.conf.SiteTitle
 	globalTP.FeedId = "index"
+	globalTP.Feeds = s.feedLinks("index")
 	globalTP.FileId = "index"
-	outHtmlName = filepath.Join(s.conf.OutDir, globalTP.FileId+".html")
-	return renderPostsListToFile(articlesForIndex, outHtmlName, globalTP, haveMoreArticles, "", engine)
+	p := postListTemplateParam{templateParam: globalTP, ShowTopicsLink: haveMoreArticles}
+	return s.renderPaginatedPostsList(articlesForIndex, globalTP.FileId+".html", "", p, engine)
 }
 
 func (s *Site) RenderAll() error {
@@ -177,7 +262,15 @@ func (s *Site) RenderAll() error {
 	if err != nil {
 		return err
 	}
-	return s.RenderAtom()
+	if !s.conf.HighlightInlineStyles {
+		if err := writeHighlightCSS(s.conf); err != nil {
+			return err
+		}
+	}
+	if err := s.RenderFeeds(); err != nil {
+		return err
+	}
+	return s.RenderSitemap()
 }
 
 func (s *Site) CopyStaticFiles() error {
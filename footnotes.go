@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// How footnotes are shown, set with SiteConf.FootnoteStyle or the post
+// flags of the same names.
+const (
+	// A numbered list at the end of the post, with links back to the
+	// references.
+	endnotesStyle = "endnotes"
+	// Tufte-style notes in the margin next to the reference.
+	sidenotesStyle = "sidenotes"
+)
+
+// A footnote of a post.
+type Footnote struct {
+	// Starts at 1.
+	Num int
+	// The ids of the note in the endnotes and of its first reference.
+	ID, RefID string
+	Content   template.HTML
+}
+
+// Renderers mark footnote references with this placeholder, which is
+// replaced by the markup for the footnote style.
+func footnotePlaceholder(num int) string {
+	return "<!--fnref:" + strconv.Itoa(num) + "-->"
+}
+
+var footnotePlaceholderRe = regexp.MustCompile(`<!--fnref:(\d+)-->`)
+
+func newFootnote(num int, content string) Footnote {
+	n := strconv.Itoa(num)
+	return Footnote{Num: num, ID: "fn:" + n, RefID: "fnref:" + n, Content: template.HTML(content)}
+}
+
+// The footnote style for p: its own sidenotes or endnotes flag, or the
+// site's style.
+func footnoteStyleFor(p *post, siteStyle string) string {
+	switch {
+	case p.hasFlag(sidenotesStyle):
+		return sidenotesStyle
+	case p.hasFlag(endnotesStyle):
+		return endnotesStyle
+	}
+	return siteStyle
+}
+
+// Replace the footnote placeholders in html with references in the given
+// style. For endnotes, the notes are appended to html.
+func placeFootnotes(html string, footnotes []Footnote, style string) string {
+	if len(footnotes) == 0 {
+		return html
+	}
+
+	numRefs := make(map[int]int)
+	html = footnotePlaceholderRe.ReplaceAllStringFunc(html, func(placeholder string) string {
+		num, _ := strconv.Atoi(footnotePlaceholderRe.FindStringSubmatch(placeholder)[1])
+		if num < 1 || num > len(footnotes) {
+			return ""
+		}
+		fn := footnotes[num-1]
+		numRefs[num]++
+
+		if style == sidenotesStyle {
+			id := "sn-" + strconv.Itoa(num)
+			if numRefs[num] > 1 {
+				id += "-" + strconv.Itoa(numRefs[num])
+			}
+			return fmt.Sprintf(`<label for="%s" class="margin-toggle sidenote-number"></label>`+
+				`<input type="checkbox" id="%s" class="margin-toggle" />`+
+				`<span class="sidenote">%s</span>`, id, id, inlineContent(fn.Content))
+		}
+
+		refID := fn.RefID
+		if numRefs[num] > 1 {
+			refID += "-" + strconv.Itoa(numRefs[num])
+		}
+		return fmt.Sprintf(`<sup class="footnote-ref" id="%s"><a href="#%s">%d</a></sup>`, refID, fn.ID, num)
+	})
+
+	if style == sidenotesStyle {
+		return html
+	}
+
+	var b strings.Builder
+	b.WriteString(html)
+	b.WriteString("<div class=\"footnotes\">\n<hr />\n<ol>\n")
+	for _, fn := range footnotes {
+		backLink := fmt.Sprintf(` <a href="#%s" class="footnote-backref">&#8617;</a>`, fn.RefID)
+		content := strings.TrimSpace(string(fn.Content))
+		if before, ok := strings.CutSuffix(content, "</p>"); ok {
+			content = before + backLink + "</p>"
+		} else {
+			content += backLink
+		}
+		fmt.Fprintf(&b, "<li id=\"%s\">%s</li>\n", fn.ID, content)
+	}
+	b.WriteString("</ol>\n</div>\n")
+	return b.String()
+}
+
+// Sidenotes are inline, so unwrap a note that is a single paragraph, and
+// turn the breaks between several paragraphs into line breaks.
+func inlineContent(content template.HTML) string {
+	s := strings.TrimSpace(string(content))
+	s = strings.TrimPrefix(s, "<p>")
+	s = strings.TrimSuffix(s, "</p>")
+	return strings.ReplaceAll(s, "</p>\n<p>", "<br /><br />")
+}
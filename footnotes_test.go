@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFootnoteReferencedTwice(t *testing.T) {
+	renderers, err := newMarkdownRenderers(&SiteConf{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := "a[^n] b[^m] c[^n]\n\n[^n]: N note.\n[^m]: M note.\n"
+
+	for _, engine := range []string{blackfridayEngine, goldmarkEngine} {
+		rendered, err := renderers[engine].render([]byte(body))
+		if err != nil {
+			t.Fatalf("%v: %v", engine, err)
+		}
+		if len(rendered.footnotes) != 2 {
+			t.Fatalf("%v: got %d footnotes, want 2", engine, len(rendered.footnotes))
+		}
+		if got := strings.TrimSpace(string(rendered.footnotes[0].Content)); strings.Count(got, "N note.") != 1 {
+			t.Errorf("%v: footnote content %q, want N note. once", engine, got)
+		}
+
+		endnotes := placeFootnotes(rendered.html, rendered.footnotes, endnotesStyle)
+		if n := strings.Count(endnotes, "N note."); n != 1 {
+			t.Errorf("%v: endnotes have N note. %d times, want once:\n%v", engine, n, endnotes)
+		}
+		if n := strings.Count(endnotes, `href="#fn:1"`); n != 2 {
+			t.Errorf("%v: %d references to note 1, want 2:\n%v", engine, n, endnotes)
+		}
+
+		sidenotes := placeFootnotes(rendered.html, rendered.footnotes, sidenotesStyle)
+		if n := strings.Count(sidenotes, "N note."); n != 2 {
+			t.Errorf("%v: sidenotes have N note. %d times, want once per reference:\n%v", engine, n, sidenotes)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Front matter formats, identified by the delimiter line that opens and
+// closes the front matter block at the very start of a post file.
+var (
+	yamlDelimiter = []byte("---")
+	tomlDelimiter = []byte("+++")
+)
+
+// Split a post file into its front matter and body if it starts with a YAML
+// or TOML front matter block. ok is false if the file has neither, and should
+// be parsed with the legacy "key: value" header format instead.
+func parseFrontMatter(content []byte) (fields []headerField, body []byte, ok bool, err error) {
+	firstLine, rest, _ := bytes.Cut(content, []byte("\n"))
+	delimiter := bytes.TrimSpace(firstLine)
+
+	var unmarshal func([]byte, any) error
+	switch {
+	case bytes.Equal(delimiter, yamlDelimiter):
+		unmarshal = yaml.Unmarshal
+	case bytes.Equal(delimiter, tomlDelimiter):
+		unmarshal = toml.Unmarshal
+	default:
+		return nil, nil, false, nil
+	}
+
+	var frontMatter []byte
+	for line := range bytes.Lines(rest) {
+		if bytes.Equal(bytes.TrimSpace(line), delimiter) {
+			body = rest[len(frontMatter)+len(line):]
+			break
+		}
+		frontMatter = rest[:len(frontMatter)+len(line)]
+	}
+	if body == nil {
+		return nil, nil, true, fmt.Errorf("front matter starting with %s is never closed", delimiter)
+	}
+
+	values := make(map[string]any)
+	if err := unmarshal(frontMatter, &values); err != nil {
+		return nil, nil, true, err
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	fields = make([]headerField, 0, len(keys))
+	for _, k := range keys {
+		fields = append(fields, headerField{key: k, vals: frontMatterStrings(values[k])})
+	}
+	return fields, body, true, nil
+}
+
+// Flatten a decoded YAML or TOML value into the string values of a header
+// field. Lists yield one string per element.
+func frontMatterStrings(v any) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case []any:
+		vals := make([]string, 0, len(v))
+		for _, elem := range v {
+			vals = append(vals, frontMatterStrings(elem)...)
+		}
+		return vals
+	case time.Time:
+		// TOML marks dates and times without an offset by these locations.
+		switch v.Location().String() {
+		case "date-local":
+			return []string{v.Format("2006-01-02")}
+		case "datetime-local":
+			return []string{v.Format("2006-01-02T15:04:05")}
+		}
+		return []string{v.Format(time.RFC3339)}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
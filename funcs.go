@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The functions available to all templates, including shortcode templates,
+// in addition to the built-in ones of text/template such as eq, lt, and
+// printf. Themes can rely on these names and signatures; they will only
+// ever be added to, not changed.
+//
+// Functions taking text accept a string, template.HTML, or []byte such as
+// a post's .Body.
+//
+//	date LAYOUT TIME
+//		Format a time.Time with a Go layout: {{.Date | date "2006-01-02"}}.
+//	slugify TEXT
+//		The text as used in heading ids: lowercase letters and digits, other
+//		characters replaced by dashes.
+//	truncate N TEXT
+//		The text cut to at most N characters at a word boundary, with "…"
+//		appended if anything was cut: {{.Blurb | truncate 80}}.
+//	absURL PATH
+//		PATH relative to BaseURL as an absolute URL. URLs with a scheme
+//		are returned as they are.
+//	relURL PATH
+//		PATH relative to BaseURL as a host-relative URL, "/blog/a.html" for
+//		"a.html" if BaseURL is "https://example.com/blog/".
+//	markdownify TEXT
+//		The text rendered as Markdown with the site's engine. A single
+//		paragraph is returned without its <p> tags.
+//	readingTime TEXT
+//		The minutes it takes to read the text, at least 1.
+//	dict KEY VALUE ...
+//		A map from the string keys to the values, e.g. to pass several
+//		values to a nested template.
+//	list VALUE ...
+//		A list of the values. Not to be confused with the built-in slice,
+//		which takes a part of a string or slice.
+//	in COLLECTION ITEM
+//		Whether the slice, array, or map keys contain ITEM, or a string
+//		contains ITEM as a substring. Strings of different types such as
+//		categories compare equal if their text is equal.
+//	default DEFAULT VALUE
+//		VALUE, or DEFAULT if VALUE is empty: {{.Blurb | default "No blurb"}}.
+func newTemplateFuncs(renderers map[string]renderer, conf *SiteConf) template.FuncMap {
+	basePath := "/"
+	if u, err := url.Parse(conf.BaseURL); err == nil && len(u.Path) > 0 {
+		basePath = u.Path
+	}
+
+	return template.FuncMap{
+		"date": func(layout string, t time.Time) string {
+			return t.Format(layout)
+		},
+		"slugify": func(text any) (string, error) {
+			s, err := toText(text)
+			return slugify(s), err
+		},
+		"truncate": func(n int, text any) (string, error) {
+			s, err := toText(text)
+			return truncate(s, n), err
+		},
+		"absURL": func(path string) string {
+			if u, err := url.Parse(path); err == nil && u.IsAbs() {
+				return path
+			}
+			return strings.TrimSuffix(conf.BaseURL, "/") + "/" + strings.TrimPrefix(path, "/")
+		},
+		"relURL": func(path string) string {
+			if u, err := url.Parse(path); err == nil && u.IsAbs() {
+				return path
+			}
+			return strings.TrimSuffix(basePath, "/") + "/" + strings.TrimPrefix(path, "/")
+		},
+		"markdownify": func(text any) (template.HTML, error) {
+			s, err := toText(text)
+			if err != nil {
+				return "", err
+			}
+			r, ok := renderers[conf.MarkdownEngine]
+			if !ok {
+				return "", fmt.Errorf("unknown Markdown engine %q", conf.MarkdownEngine)
+			}
+			rendered, err := r.render([]byte(s))
+			if err != nil {
+				return "", err
+			}
+			return template.HTML(unwrapParagraph(rendered.html)), nil
+		},
+		"readingTime": func(text any) (int, error) {
+			s, err := toText(text)
+			return readingTime(s), err
+		},
+		"dict": func(keysAndValues ...any) (map[string]any, error) {
+			if len(keysAndValues)%2 != 0 {
+				return nil, fmt.Errorf("dict needs pairs of keys and values, got %d arguments", len(keysAndValues))
+			}
+			d := make(map[string]any, len(keysAndValues)/2)
+			for i := 0; i < len(keysAndValues); i += 2 {
+				key, ok := keysAndValues[i].(string)
+				if !ok {
+					return nil, fmt.Errorf("dict key %v is not a string", keysAndValues[i])
+				}
+				d[key] = keysAndValues[i+1]
+			}
+			return d, nil
+		},
+		"list": func(values ...any) []any {
+			return values
+		},
+		"in":      in,
+		"default": defaultValue,
+	}
+}
+
+// The text of a template function argument.
+func toText(v any) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case template.HTML:
+		return string(t), nil
+	case []byte:
+		return string(t), nil
+	case fmt.Stringer:
+		return t.String(), nil
+	}
+	return "", fmt.Errorf("expected text, got %T", v)
+}
+
+// s cut to at most n characters at a word boundary, with "…" appended if
+// anything was cut.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	cut := string(runes[:n])
+	if i := strings.LastIndexAny(cut, " \t\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " \t\n.,;:") + "…"
+}
+
+// The HTML of a single paragraph without its <p> tags. Anything else is
+// returned unchanged.
+func unwrapParagraph(html string) string {
+	s := strings.TrimSpace(html)
+	if strings.HasPrefix(s, "<p>") && strings.HasSuffix(s, "</p>") && strings.Count(s, "<p>") == 1 {
+		return s[len("<p>") : len(s)-len("</p>")]
+	}
+	return html
+}
+
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// Reading speed in words per minute for readingTime.
+const wordsPerMinute = 200
+
+// The minutes it takes to read text, which may be Markdown or HTML.
+func readingTime(text string) int {
+	words := len(strings.Fields(htmlTagRe.ReplaceAllString(text, " ")))
+	return max(1, (words+wordsPerMinute-1)/wordsPerMinute)
+}
+
+// Whether collection contains item, see newTemplateFuncs.
+func in(collection, item any) (bool, error) {
+	c := reflect.ValueOf(collection)
+	it := reflect.ValueOf(item)
+	switch c.Kind() {
+	case reflect.String:
+		s, err := toText(item)
+		return err == nil && strings.Contains(c.String(), s), nil
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < c.Len(); i++ {
+			if sameValue(c.Index(i), it) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reflect.Map:
+		for _, key := range c.MapKeys() {
+			if sameValue(key, it) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reflect.Invalid:
+		return false, nil
+	}
+	return false, fmt.Errorf("in: can't look for items in %T", collection)
+}
+
+func sameValue(a, b reflect.Value) bool {
+	for a.Kind() == reflect.Interface {
+		a = a.Elem()
+	}
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	if a.Kind() == reflect.String && b.Kind() == reflect.String {
+		return a.String() == b.String()
+	}
+	return a.Type() == b.Type() && a.Comparable() && b.Comparable() && a.Equal(b)
+}
+
+// value, or def if value is the zero value of its type or an empty slice or
+// map.
+func defaultValue(def, value any) any {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() || v.IsZero() {
+		return def
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		if v.Len() == 0 {
+			return def
+		}
+	}
+	return value
+}
@@ -3,13 +3,18 @@ module github.com/thomas11/blog11
 go 1.25
 
 require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/alecthomas/chroma/v2 v2.23.1
 	github.com/otiai10/copy v1.14.1
 	github.com/radovskyb/watcher v1.0.7
 	github.com/russross/blackfriday/v2 v2.1.0
-	github.com/thomas11/atomgenerator v0.0.0-20140514140532-0b3b01da14a4
+	github.com/wyatt915/treeblood v0.1.16
+	github.com/yuin/goldmark v1.7.13
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/dlclark/regexp2 v1.11.5 // indirect
 	github.com/otiai10/mint v1.6.3 // indirect
 	golang.org/x/sync v0.19.0 // indirect
 	golang.org/x/sys v0.40.0 // indirect
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	gmast "github.com/yuin/goldmark/extension/ast"
+	gmrenderer "github.com/yuin/goldmark/renderer"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// The goldmark extensions that can be named in SiteConf.MarkdownExtensions.
+var goldmarkExtensions = map[string]goldmark.Extender{
+	"gfm":            extension.GFM,
+	"table":          extension.Table,
+	"strikethrough":  extension.Strikethrough,
+	"linkify":        extension.Linkify,
+	"taskList":       extension.TaskList,
+	"footnote":       extension.Footnote,
+	"definitionList": extension.DefinitionList,
+	"typographer":    extension.Typographer,
+	"cjk":            extension.CJK,
+}
+
+var defaultGoldmarkExtensions = []string{"gfm", "footnote", "definitionList", "typographer"}
+
+// A CommonMark renderer.
+type goldmarkHTMLRenderer struct {
+	md goldmark.Markdown
+}
+
+// Create a goldmark renderer with the named extensions, or GFM, footnotes,
+// definition lists and typographic replacements if there are none.
+func newGoldmarkRenderer(extNames []string, h *highlighter) (renderer, error) {
+	if len(extNames) == 0 {
+		extNames = defaultGoldmarkExtensions
+	}
+	exts := make([]goldmark.Extender, 0, len(extNames))
+	for _, name := range extNames {
+		ext, ok := goldmarkExtensions[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown goldmark extension %q", name)
+		}
+		exts = append(exts, ext)
+	}
+
+	md := goldmark.New(
+		goldmark.WithExtensions(exts...),
+		goldmark.WithRendererOptions(
+			gmhtml.WithXHTML(),
+			gmhtml.WithUnsafe(),
+			gmrenderer.WithNodeRenderers(
+				util.Prioritized(&goldmarkCodeBlockRenderer{h}, 100),
+				util.Prioritized(goldmarkFootnoteRenderer{}, 100),
+			),
+		),
+	)
+	return &goldmarkHTMLRenderer{md: md}, nil
+}
+
+// The id that h has from an attribute, if any.
+func goldmarkHeadingID(h *ast.Heading) (string, bool) {
+	id, ok := h.AttributeString("id")
+	if !ok {
+		return "", false
+	}
+	b, ok := id.([]byte)
+	if !ok || len(b) == 0 {
+		return "", false
+	}
+	return string(b), true
+}
+
+func (g *goldmarkHTMLRenderer) render(in []byte) (renderedMarkdown, error) {
+	doc := g.md.Parser().Parse(text.NewReader(in))
+
+	var headingNodes []*ast.Heading
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if h, ok := n.(*ast.Heading); ok && entering {
+			headingNodes = append(headingNodes, h)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// Give all headings a unique id. Ids set with attributes are kept as they
+	// are, so they're reserved first.
+	ids := make(headingIDs)
+	var duplicateIDs []string
+	for _, h := range headingNodes {
+		if id, ok := goldmarkHeadingID(h); ok && !ids.addExplicit(id) {
+			duplicateIDs = append(duplicateIDs, id)
+		}
+	}
+	headings := make([]TocEntry, 0, len(headingNodes))
+	for _, h := range headingNodes {
+		e := TocEntry{Level: h.Level, Title: nodeText(h, in)}
+		id, ok := goldmarkHeadingID(h)
+		if !ok {
+			id = ids.forHeading(e.Title)
+			h.SetAttributeString("id", []byte(id))
+		}
+		e.ID = id
+		headings = append(headings, e)
+	}
+
+	rendered := renderedMarkdown{toc: buildToc(headings), duplicateIDs: duplicateIDs}
+
+	// The footnote list is last in the document, ordered by index.
+	if list, ok := doc.LastChild().(*gmast.FootnoteList); ok {
+		for c := list.FirstChild(); c != nil; c = c.NextSibling() {
+			fn := c.(*gmast.Footnote)
+			var b bytes.Buffer
+			for child := fn.FirstChild(); child != nil; child = child.NextSibling() {
+				if err := g.md.Renderer().Render(&b, in, child); err != nil {
+					return rendered, err
+				}
+			}
+			rendered.footnotes = append(rendered.footnotes, newFootnote(fn.Index, b.String()))
+		}
+	}
+
+	var b bytes.Buffer
+	if err := g.md.Renderer().Render(&b, in, doc); err != nil {
+		return rendered, err
+	}
+	rendered.html = b.String()
+	return rendered, nil
+}
+
+// The plain text of n and its children.
+func nodeText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			switch c := c.(type) {
+			case *ast.Text:
+				b.Write(c.Segment.Value(source))
+			case *ast.String:
+				b.Write(c.Value)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// Renders fenced code blocks through the highlighter if it knows their
+// language, and like goldmark does otherwise.
+type goldmarkCodeBlockRenderer struct {
+	highlighter *highlighter
+}
+
+func (r *goldmarkCodeBlockRenderer) RegisterFuncs(reg gmrenderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r *goldmarkCodeBlockRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.FencedCodeBlock)
+	var code bytes.Buffer
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		code.Write(line.Value(source))
+	}
+	lang := string(n.Language(source))
+
+	if len(lang) > 0 && r.highlighter != nil {
+		var b bytes.Buffer
+		ok, err := r.highlighter.highlight(&b, code.String(), lang)
+		if err != nil {
+			return ast.WalkStop, err
+		}
+		if ok {
+			_, err = w.Write(b.Bytes())
+			return ast.WalkSkipChildren, err
+		}
+	}
+
+	w.WriteString("<pre><code")
+	if len(lang) > 0 {
+		w.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+	}
+	w.WriteString(">" + html.EscapeString(code.String()) + "</code></pre>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// Renders footnote references as placeholders for placeFootnotes, and
+// leaves out the footnote list and back links.
+type goldmarkFootnoteRenderer struct{}
+
+func (r goldmarkFootnoteRenderer) RegisterFuncs(reg gmrenderer.NodeRendererFuncRegisterer) {
+	reg.Register(gmast.KindFootnoteLink, r.renderFootnoteLink)
+	reg.Register(gmast.KindFootnoteBacklink, r.skip)
+	reg.Register(gmast.KindFootnoteList, r.skip)
+}
+
+func (r goldmarkFootnoteRenderer) renderFootnoteLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.WriteString(footnotePlaceholder(node.(*gmast.FootnoteLink).Index))
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r goldmarkFootnoteRenderer) skip(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	return ast.WalkSkipChildren, nil
+}
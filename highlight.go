@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// The stylesheet for class-based highlighting, relative to OutDir.
+const highlightCSSFile = "highlight.css"
+
+var highlightDirective = []byte("!highlight")
+
+// Syntax highlights code blocks using chroma.
+type highlighter struct {
+	style     *chroma.Style
+	formatter *html.Formatter
+}
+
+func newHighlighter(conf *SiteConf) (*highlighter, error) {
+	style, ok := styles.Registry[strings.ToLower(conf.HighlightStyle)]
+	if !ok {
+		return nil, fmt.Errorf("unknown highlight style %q", conf.HighlightStyle)
+	}
+	return &highlighter{
+		style:     style,
+		formatter: html.New(html.WithClasses(!conf.HighlightInlineStyles)),
+	}, nil
+}
+
+// Write code highlighted as lang to w. Returns false without writing anything
+// if lang is not a language we know.
+func (h *highlighter) highlight(w io.Writer, code, lang string) (bool, error) {
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		return false, nil
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return false, err
+	}
+	return true, h.formatter.Format(w, h.style, iterator)
+}
+
+func (h *highlighter) writeCSS(w io.Writer) error {
+	return h.formatter.WriteCSS(w, h.style)
+}
+
+// Write the stylesheet for the configured highlight style to OutDir.
+func writeHighlightCSS(conf *SiteConf) error {
+	h, err := newHighlighter(conf)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := h.writeCSS(&b); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(conf.OutDir, 0o775); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(conf.OutDir, highlightCSSFile), b.Bytes(), 0o664)
+}
+
+func isCodeFence(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("```")) || bytes.HasPrefix(line, []byte("~~~"))
+}
+
+func isIndentedCode(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("    ")) || bytes.HasPrefix(line, []byte("\t"))
+}
+
+// Apply "!highlight <lang>" directives to the code block that follows them,
+// and strip the directives. A fenced block gets lang as its info string
+// unless it already has one, an indented block is turned into a fenced one.
+// Any other text before the next code block cancels the directive.
+// Directives inside fenced blocks are left alone.
+func highlightCode(text []byte) []byte {
+	newText := bytes.NewBuffer(make([]byte, 0, len(text)))
+	lang := ""
+	// The opening fence, such as "```", while in a fenced block.
+	var fence []byte
+
+	var indented [][]byte
+	flushIndented := func() {
+		// Trailing blank lines are not part of the block.
+		end := len(indented)
+		for end > 0 && len(bytes.TrimSpace(indented[end-1])) == 0 {
+			end--
+		}
+		newText.WriteString("```" + lang + "\n")
+		for _, l := range indented[:end] {
+			switch {
+			case len(bytes.TrimSpace(l)) == 0:
+				newText.WriteString("\n")
+				continue
+			case l[0] == '\t':
+				newText.Write(l[1:])
+			default:
+				newText.Write(l[4:])
+			}
+			if !bytes.HasSuffix(l, []byte("\n")) {
+				newText.WriteString("\n")
+			}
+		}
+		newText.WriteString("```\n")
+		for _, l := range indented[end:] {
+			newText.Write(l)
+		}
+		indented = nil
+		lang = ""
+	}
+
+	for line := range bytes.Lines(text) {
+		trimmed := bytes.TrimSpace(line)
+
+		if fence != nil {
+			// The block ends with a fence of the same character, at least
+			// as long as the opening one.
+			if bytes.HasPrefix(trimmed, fence) && len(bytes.Trim(trimmed, string(fence[:1]))) == 0 {
+				fence = nil
+			}
+			newText.Write(line)
+			continue
+		}
+
+		if indented != nil {
+			if len(trimmed) == 0 || isIndentedCode(line) {
+				indented = append(indented, line)
+				continue
+			}
+			flushIndented()
+		}
+
+		switch {
+		case bytes.HasPrefix(trimmed, highlightDirective):
+			lang = string(bytes.TrimSpace(trimmed[len(highlightDirective):]))
+			continue
+		case isCodeFence(trimmed) && !isIndentedCode(line):
+			fence = trimmed[:len(trimmed)-len(bytes.TrimLeft(trimmed, string(trimmed[:1])))]
+			if len(lang) > 0 && len(bytes.TrimLeft(trimmed, "`~")) == 0 {
+				newText.Write(bytes.TrimRight(line, "\r\n"))
+				newText.WriteString(lang + "\n")
+				lang = ""
+				continue
+			}
+			lang = ""
+		case len(lang) == 0 || len(trimmed) == 0:
+		case isIndentedCode(line):
+			indented = append(indented, line)
+			continue
+		default:
+			lang = ""
+		}
+		newText.Write(line)
+	}
+	if indented != nil {
+		flushIndented()
+	}
+
+	return newText.Bytes()
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestHighlightCode(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"!highlight go\n```\nx := 1\n```\n", "```go\nx := 1\n```\n"},
+		{"!highlight go\n```python\nx = 1\n```\n", "```python\nx = 1\n```\n"},
+		{"!highlight go\n\n    x := 1\n\nafter\n", "\n```go\nx := 1\n```\n\nafter\n"},
+		{"!highlight go\ntext\n```\nx\n```\n", "text\n```\nx\n```\n"},
+		// Directives inside fenced blocks are code.
+		{"```\n!highlight go\n```\n", "```\n!highlight go\n```\n"},
+		{"````md\n```\n!highlight go\n```\n````\n!highlight go\n```\nx\n```\n", "````md\n```\n!highlight go\n```\n````\n```go\nx\n```\n"},
+		{"~~~\n!highlight go\n```\n~~~\n", "~~~\n!highlight go\n```\n~~~\n"},
+	}
+	for _, test := range tests {
+		if got := string(highlightCode([]byte(test.text))); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// JSON Feed 1.1, see https://www.jsonfeed.org/version/1.1/. Like the RSS
+// feed, it's made from the Atom feed.
+
+const (
+	jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+	// The site's JSON Feed is feed.json rather than index.json, as is
+	// customary.
+	jsonFeedIndexFile = "feed.json"
+)
+
+type jsonFeedAuthor struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []*jsonFeedItem  `json:"items"`
+}
+
+func jsonFeedAuthors(persons []atomPerson) []jsonFeedAuthor {
+	var authors []jsonFeedAuthor
+	for _, p := range persons {
+		authors = append(authors, jsonFeedAuthor{Name: p.Name, URL: p.URI})
+	}
+	return authors
+}
+
+// The JSON Feed of an Atom feed, published at feedURL.
+func jsonFeedFromAtom(f *atomFeed, feedURL string) *jsonFeed {
+	feed := &jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.Link.Href,
+		FeedURL:     feedURL,
+		Authors:     jsonFeedAuthors(f.Authors),
+		Items:       make([]*jsonFeedItem, 0, len(f.Entries)),
+	}
+
+	for _, e := range f.Entries {
+		item := &jsonFeedItem{
+			ID:            e.ID,
+			URL:           e.Link.Href,
+			Title:         e.Title,
+			DatePublished: e.Published,
+			DateModified:  e.Updated,
+			Authors:       jsonFeedAuthors(e.Authors),
+		}
+		if e.Summary != nil {
+			item.Summary = e.Summary.Body
+			if e.Summary.Type == "html" {
+				item.Summary = plainText(e.Summary.Body)
+			}
+		}
+		// Items must have content, so summary-only feeds repeat the summary.
+		if e.Content != nil {
+			item.ContentHTML = e.Content.Body
+		} else if e.Summary != nil {
+			item.ContentHTML = e.Summary.html()
+		}
+		for _, c := range e.Categories {
+			item.Tags = append(item.Tags, c.Term)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+// The text of an HTML fragment, without tags and entities, for summaries
+// made from the post, which the spec wants to be plain text.
+func plainText(fragment string) string {
+	text := html.UnescapeString(htmlTagRe.ReplaceAllString(fragment, " "))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// Check the feed against the requirements of the spec. Returns all problems
+// found.
+func (f *jsonFeed) validate() []error {
+	errs := make([]error, 0, 5)
+
+	if f.Version != jsonFeedVersion {
+		errs = append(errs, fmt.Errorf("feed version must be %v", jsonFeedVersion))
+	}
+	if len(f.Title) == 0 {
+		errs = append(errs, errors.New("feed must have a title"))
+	}
+	for _, u := range []string{f.HomePageURL, f.FeedURL} {
+		if !isAbsURL(u) {
+			errs = append(errs, fmt.Errorf("feed URL %q must be absolute", u))
+		}
+	}
+	for i, a := range f.Authors {
+		if len(a.Name) == 0 && len(a.URL) == 0 {
+			errs = append(errs, fmt.Errorf("feed author %v must have a name or URL", i))
+		}
+	}
+
+	ids := make(map[string]bool, len(f.Items))
+	for i, item := range f.Items {
+		if len(item.ID) == 0 {
+			errs = append(errs, fmt.Errorf("item %v must have an id", i))
+		} else if ids[item.ID] {
+			errs = append(errs, fmt.Errorf("item %v has the same id as an earlier item: %v", i, item.ID))
+		}
+		ids[item.ID] = true
+		if len(item.ContentHTML) == 0 {
+			errs = append(errs, fmt.Errorf("item %v must have content", item.ID))
+		}
+		if len(item.URL) > 0 && !isAbsURL(item.URL) {
+			errs = append(errs, fmt.Errorf("URL of item %v must be absolute", item.ID))
+		}
+		for _, d := range []string{item.DatePublished, item.DateModified} {
+			if _, err := time.Parse(time.RFC3339, d); len(d) > 0 && err != nil {
+				errs = append(errs, fmt.Errorf("date %q of item %v is not in RFC 3339 format", d, item.ID))
+			}
+		}
+		for j, a := range item.Authors {
+			if len(a.Name) == 0 && len(a.URL) == 0 {
+				errs = append(errs, fmt.Errorf("author %v of item %v must have a name or URL", j, item.ID))
+			}
+		}
+	}
+
+	return errs
+}
+
+func isAbsURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.IsAbs()
+}
+
+func (f *jsonFeed) genJSON() ([]byte, error) {
+	errs := f.validate()
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("JSON Feed %v is not valid: %w", f.FeedURL, errors.Join(errs...))
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A site writing only JSON Feeds, with two posts and a static page, rendered
+// as if by RenderHtml.
+func newJSONFeedTestSite(t *testing.T) *Site {
+	conf := &SiteConf{
+		Author:       "Jane Doe",
+		AuthorURI:    "https://example.com/jane",
+		BaseURL:      "https://example.com/blog/",
+		SiteTitle:    "Test Blog",
+		OutDir:       t.TempDir(),
+		Taxonomies:   []TaxonomyConf{defaultTaxonomy("categories")},
+		FeedFormats:  []string{jsonFeedFormat},
+		TagAuthority: "example.com",
+		TagDate:      "2020-01-01",
+		FeedContent:  feedContentFull,
+	}
+	if err := os.MkdirAll(filepath.Join(conf.OutDir, "categories"), 0o775); err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(s string) time.Time {
+		d, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	s := &Site{
+		conf: conf,
+		posts: posts{
+			{
+				Title: "Second <post>", ID: "second", Date: date("2024-03-02"), Updated: date("2024-04-01"),
+				Terms: map[string][]category{"categories": {"go", "web dev"}},
+			},
+			{
+				Title: "First post", ID: "first", Date: date("2024-01-31"),
+				Terms: map[string][]category{"categories": {"go"}},
+			},
+			{Title: "About", ID: "about", Flags: []string{"static"}},
+		},
+		renderCache: map[string]string{
+			"second": "<p>Second &amp; last.</p>\n",
+			"first":  "<p>First.</p>\n",
+			"about":  "<p>About me.</p>\n",
+		},
+	}
+	return s
+}
+
+// Read the JSON Feed at path and check it against the JSON Feed 1.1 spec.
+// Returns the ids of its items.
+func checkJSONFeed(t *testing.T, path, wantURL string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed map[string]any
+	if err := json.Unmarshal(data, &feed); err != nil {
+		t.Fatalf("%v: %v", path, err)
+	}
+
+	if feed["version"] != "https://jsonfeed.org/version/1.1" {
+		t.Errorf("%v: version is %v", path, feed["version"])
+	}
+	if title, _ := feed["title"].(string); len(title) == 0 {
+		t.Errorf("%v: no title", path)
+	}
+	if feed["feed_url"] != wantURL {
+		t.Errorf("%v: feed_url is %v, want %v", path, feed["feed_url"], wantURL)
+	}
+	for _, key := range []string{"home_page_url", "feed_url"} {
+		if u, _ := feed[key].(string); !isAbsURL(u) {
+			t.Errorf("%v: %v %q is not absolute", path, key, u)
+		}
+	}
+	items, ok := feed["items"].([]any)
+	if !ok {
+		t.Fatalf("%v: items is %T, want an array", path, feed["items"])
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for i, it := range items {
+		item, ok := it.(map[string]any)
+		if !ok {
+			t.Fatalf("%v: item %v is %T, want an object", path, i, it)
+		}
+		id, _ := item["id"].(string)
+		if len(id) == 0 {
+			t.Errorf("%v: item %v has no id", path, i)
+		} else if seen[id] {
+			t.Errorf("%v: item %v has the same id as an earlier one: %v", path, i, id)
+		}
+		seen[id] = true
+		ids = append(ids, id)
+
+		if content, _ := item["content_html"].(string); len(content) == 0 {
+			t.Errorf("%v: item %v has no content_html", path, id)
+		}
+		if u, _ := item["url"].(string); !isAbsURL(u) {
+			t.Errorf("%v: url %q of item %v is not absolute", path, u, id)
+		}
+		for _, key := range []string{"date_published", "date_modified"} {
+			d, _ := item[key].(string)
+			if _, err := time.Parse(time.RFC3339, d); err != nil {
+				t.Errorf("%v: %v %q of item %v is not in RFC 3339 format", path, key, d, id)
+			}
+		}
+	}
+	return ids
+}
+
+func homePageURL(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed jsonFeed
+	if err := json.Unmarshal(data, &feed); err != nil {
+		t.Fatal(err)
+	}
+	return feed.HomePageURL
+}
+
+func TestRenderJSONFeeds(t *testing.T) {
+	s := newJSONFeedTestSite(t)
+	if err := s.RenderFeeds(); err != nil {
+		t.Fatal(err)
+	}
+	out := s.conf.OutDir
+
+	ids := checkJSONFeed(t, filepath.Join(out, "feed.json"), "https://example.com/blog/feed.json")
+	if len(ids) != 2 {
+		t.Errorf("feed.json has %d items, want the 2 posts without the static page", len(ids))
+	}
+	goIDs := checkJSONFeed(t, filepath.Join(out, "categories", "go.json"), "https://example.com/blog/categories/go.json")
+	if strings.Join(goIDs, " ") != strings.Join(ids, " ") {
+		t.Errorf("categories/go.json has items %v, want %v", goIDs, ids)
+	}
+	if got, want := homePageURL(t, filepath.Join(out, "categories", "go.json")), "https://example.com/blog/categories/go.html"; got != want {
+		t.Errorf("categories/go.json links to %v, want the category page %v", got, want)
+	}
+	webIDs := checkJSONFeed(t, filepath.Join(out, "categories", "web_dev.json"), "https://example.com/blog/categories/web_dev.json")
+	if len(webIDs) != 1 || webIDs[0] != ids[0] {
+		t.Errorf("categories/web_dev.json has items %v, want [%v]", webIDs, ids[0])
+	}
+
+	for _, name := range []string{"index.xml", "index.json"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err == nil {
+			t.Errorf("%v written, but only JSON Feed is enabled", name)
+		}
+	}
+}
+
+func TestJSONFeedValidate(t *testing.T) {
+	valid := func() *jsonFeed {
+		return &jsonFeed{
+			Version:     jsonFeedVersion,
+			Title:       "Test",
+			HomePageURL: "https://example.com/",
+			FeedURL:     "https://example.com/feed.json",
+			Items: []*jsonFeedItem{
+				{ID: "a", URL: "https://example.com/a.html", ContentHTML: "<p>A</p>", DatePublished: "2024-01-31T00:00:00Z"},
+				{ID: "b", URL: "https://example.com/b.html", ContentHTML: "<p>B</p>"},
+			},
+		}
+	}
+	if errs := valid().validate(); len(errs) > 0 {
+		t.Fatalf("valid feed: %v", errs)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(f *jsonFeed)
+	}{
+		{"wrong version", func(f *jsonFeed) { f.Version = "https://jsonfeed.org/version/1" }},
+		{"no title", func(f *jsonFeed) { f.Title = "" }},
+		{"relative feed URL", func(f *jsonFeed) { f.FeedURL = "/feed.json" }},
+		{"duplicate id", func(f *jsonFeed) { f.Items[1].ID = "a" }},
+		{"no content", func(f *jsonFeed) { f.Items[0].ContentHTML = "" }},
+		{"relative item URL", func(f *jsonFeed) { f.Items[0].URL = "a.html" }},
+		{"bad date", func(f *jsonFeed) { f.Items[0].DatePublished = "2024-01-31" }},
+	}
+	for _, test := range tests {
+		f := valid()
+		test.modify(f)
+		if errs := f.validate(); len(errs) == 0 {
+			t.Errorf("%v: no error", test.name)
+		}
+		if _, err := f.genJSON(); err == nil {
+			t.Errorf("%v: genJSON wrote an invalid feed", test.name)
+		}
+	}
+}
+
+// In summary mode, the summary of posts without blurb is their first
+// paragraph, which is HTML. Their text is used, while blurbs are used as
+// they are.
+func TestJSONFeedSummaryIsPlainText(t *testing.T) {
+	s := newJSONFeedTestSite(t)
+	s.conf.FeedContent = feedContentSummary
+	s.posts[1].Blurb = "Q&A about <things>"
+	if err := s.RenderFeeds(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.conf.OutDir, "feed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed jsonFeed
+	if err := json.Unmarshal(data, &feed); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ summary, content string }{
+		{"Second & last.", "<p>Second &amp; last.</p>"},
+		// Blurbs are plain text already.
+		{"Q&A about <things>", "Q&amp;A about &lt;things&gt;"},
+	}
+	if len(feed.Items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(feed.Items), len(want))
+	}
+	for i, item := range feed.Items {
+		if item.Summary != want[i].summary {
+			t.Errorf("item %v: summary %q, want %q", item.ID, item.Summary, want[i].summary)
+		}
+		if item.ContentHTML != want[i].content {
+			t.Errorf("item %v: content_html %q, want %q", item.ID, item.ContentHTML, want[i].content)
+		}
+	}
+}
@@ -1,53 +1,357 @@
 package main
 
 import (
-	"regexp"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/russross/blackfriday/v2"
 )
 
+// The Markdown engines, by the name used in SiteConf.MarkdownEngine and the
+// markdown post header.
+const (
+	blackfridayEngine = "blackfriday"
+	goldmarkEngine    = "goldmark"
+)
+
 var extensions = blackfriday.NoIntraEmphasis |
 	blackfriday.Tables |
 	blackfriday.FencedCode |
 	blackfriday.Autolink |
-	blackfriday.Strikethrough
+	blackfriday.Strikethrough |
+	blackfriday.Footnotes
+
+// The blackfriday extensions that can be named in
+// SiteConf.MarkdownExtensions.
+var blackfridayExtensions = map[string]blackfriday.Extensions{
+	"noIntraEmphasis":    blackfriday.NoIntraEmphasis,
+	"tables":             blackfriday.Tables,
+	"fencedCode":         blackfriday.FencedCode,
+	"autolink":           blackfriday.Autolink,
+	"strikethrough":      blackfriday.Strikethrough,
+	"footnotes":          blackfriday.Footnotes,
+	"definitionLists":    blackfriday.DefinitionLists,
+	"headingIDs":         blackfriday.HeadingIDs,
+	"autoHeadingIDs":     blackfriday.AutoHeadingIDs,
+	"hardLineBreak":      blackfriday.HardLineBreak,
+	"backslashLineBreak": blackfriday.BackslashLineBreak,
+}
 
-var emptyTopLevelInTocStart = regexp.MustCompile(`<nav>\s*<ul>\s*<li>\s*<ul>\s*<li>`)
-var emptyTopLevelInTocEnd = regexp.MustCompile(`</li>\s*</ul>\s*</nav>`)
+// Create a renderer for each Markdown engine, with the extensions configured
+// for it in conf.
+func newMarkdownRenderers(conf *SiteConf, h *highlighter) (map[string]renderer, error) {
+	bf, err := newBlackfridayRenderer(conf.MarkdownExtensions[blackfridayEngine], h)
+	if err != nil {
+		return nil, err
+	}
+	gm, err := newGoldmarkRenderer(conf.MarkdownExtensions[goldmarkEngine], h)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]renderer{blackfridayEngine: bf, goldmarkEngine: gm}, nil
+}
 
-func createHTMLFlags(generateToc bool) blackfriday.HTMLFlags {
-	htmlFlags := blackfriday.UseXHTML |
-		blackfriday.Smartypants |
-		blackfriday.SmartypantsFractions |
-		blackfriday.SmartypantsLatexDashes
+var htmlFlags = blackfriday.UseXHTML |
+	blackfriday.Smartypants |
+	blackfriday.SmartypantsFractions |
+	blackfriday.SmartypantsLatexDashes
 
-	if generateToc {
-		htmlFlags |= blackfriday.TOC
+// Create a blackfriday renderer with the named extensions, or the default
+// extensions if there are none.
+func newBlackfridayRenderer(extNames []string, h *highlighter) (renderer, error) {
+	exts := extensions
+	if len(extNames) > 0 {
+		exts = 0
+		for _, name := range extNames {
+			ext, ok := blackfridayExtensions[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown blackfriday extension %q", name)
+			}
+			exts |= ext
+		}
 	}
+	return &blackfridayHTMLRenderer{extensions: exts, highlighter: h}, nil
+}
 
-	return htmlFlags
+type blackfridayHTMLRenderer struct {
+	extensions  blackfriday.Extensions
+	highlighter *highlighter
 }
 
-func newMarkdownRenderer() renderer {
-	return &blackfridayHTMLRenderer{}
+// Renders fenced code blocks with a language in their info string through
+// the highlighter, everything else like blackfriday's HTMLRenderer.
+type highlightingHTMLRenderer struct {
+	*blackfriday.HTMLRenderer
+	highlighter *highlighter
 }
 
-type blackfridayHTMLRenderer struct{}
+func (r *highlightingHTMLRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if node.Type == blackfriday.CodeBlock && r.highlighter != nil {
+		if lang, _, _ := strings.Cut(string(node.Info), " "); len(lang) > 0 {
+			var b bytes.Buffer
+			ok, err := r.highlighter.highlight(&b, string(node.Literal), lang)
+			if ok && err == nil {
+				w.Write(b.Bytes())
+				return blackfriday.GoToNext
+			}
+		}
+	}
+
+	// Footnotes are placed by placeFootnotes.
+	if node.Type == blackfriday.Link && node.NoteID != 0 {
+		if entering {
+			io.WriteString(w, footnotePlaceholder(node.NoteID))
+		}
+		return blackfriday.SkipChildren
+	}
+	if node.Type == blackfriday.List && node.IsFootnotesList {
+		return blackfriday.SkipChildren
+	}
 
-func (b *blackfridayHTMLRenderer) render(in []byte, generateToc bool) string {
-	htmlFlags := createHTMLFlags(generateToc)
-	r := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
-		Flags: htmlFlags,
+	return r.HTMLRenderer.RenderNode(w, node, entering)
+}
+
+// Render the children of node.
+func (r *highlightingHTMLRenderer) renderChildren(node *blackfriday.Node) string {
+	var buf bytes.Buffer
+	for c := node.FirstChild; c != nil; c = c.Next {
+		c.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+			return r.RenderNode(&buf, n, entering)
+		})
+	}
+	return buf.String()
+}
+
+func (b *blackfridayHTMLRenderer) render(in []byte) (renderedMarkdown, error) {
+	root := blackfriday.New(blackfriday.WithExtensions(b.extensions)).Parse(in)
+
+	var headingNodes []*blackfriday.Node
+	root.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if node.Type != blackfriday.Heading || node.IsTitleblock || !entering {
+			return blackfriday.GoToNext
+		}
+		headingNodes = append(headingNodes, node)
+		return blackfriday.SkipChildren
 	})
-	html := string(blackfriday.Run(in,
-		blackfriday.WithExtensions(extensions),
-		blackfriday.WithRenderer(r)))
 
-	// Replace unnecessary nesting in ToC when we don't have an h1 heading
-	if generateToc && emptyTopLevelInTocStart.MatchString(html) {
-		html = emptyTopLevelInTocStart.ReplaceAllLiteralString(html, `<nav><ul><li>`)
-		html = emptyTopLevelInTocEnd.ReplaceAllLiteralString(html, `</nav>`)
+	// Give all headings a unique id. Ids from the headingIDs extension are
+	// kept as they are, so they're reserved first. Those from the
+	// autoHeadingIDs extension are kept if they are unique.
+	ids := make(headingIDs)
+	var duplicateIDs []string
+	explicit := make(map[*blackfriday.Node]bool)
+	for _, node := range headingNodes {
+		auto := b.extensions&blackfriday.AutoHeadingIDs != 0 &&
+			node.HeadingID == blackfriday.SanitizedAnchorName(blackfridayNodeText(node))
+		if len(node.HeadingID) > 0 && !auto {
+			explicit[node] = true
+			if !ids.addExplicit(node.HeadingID) {
+				duplicateIDs = append(duplicateIDs, node.HeadingID)
+			}
+		}
+	}
+	headings := make([]TocEntry, 0, len(headingNodes))
+	for _, node := range headingNodes {
+		text := blackfridayNodeText(node)
+		switch {
+		case explicit[node]:
+		case len(node.HeadingID) > 0:
+			node.HeadingID = ids.add(node.HeadingID)
+		default:
+			node.HeadingID = ids.forHeading(text)
+		}
+		headings = append(headings, TocEntry{Level: node.Level, ID: node.HeadingID, Title: text})
+	}
+
+	r := &highlightingHTMLRenderer{
+		HTMLRenderer: blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+			Flags: htmlFlags,
+		}),
+		highlighter: b.highlighter,
+	}
+
+	// Number the footnotes in the order of their first reference. Blackfriday
+	// gives each reference a new NoteID, even if it refers to the same note
+	// as an earlier one. It also parses the note again for each reference,
+	// appending a copy of its content, so only the first copy is kept.
+	numRefs := make(map[string]int)
+	root.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if node.Type == blackfriday.Link && node.NoteID != 0 && entering {
+			numRefs[string(node.Destination)]++
+		}
+		return blackfriday.GoToNext
+	})
+	items := make(map[string]*blackfriday.Node)
+	for c := root.FirstChild; c != nil; c = c.Next {
+		if c.Type == blackfriday.List && c.IsFootnotesList {
+			for item := c.FirstChild; item != nil; item = item.Next {
+				if _, ok := items[string(item.RefLink)]; !ok {
+					items[string(item.RefLink)] = item
+					dedupeNoteContent(item, numRefs[string(item.RefLink)])
+				}
+			}
+		}
 	}
+	footnotes := make([]Footnote, 0, len(items))
+	noteNums := make(map[string]int)
+	root.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if node.Type != blackfriday.Link || node.NoteID == 0 || !entering {
+			return blackfriday.GoToNext
+		}
+		ref := string(node.Destination)
+		num, ok := noteNums[ref]
+		if !ok {
+			num = len(footnotes) + 1
+			noteNums[ref] = num
+			content := ""
+			if item, ok := items[ref]; ok {
+				content = r.renderChildren(item)
+			}
+			footnotes = append(footnotes, newFootnote(num, content))
+		}
+		node.NoteID = num
+		return blackfriday.SkipChildren
+	})
+
+	var buf bytes.Buffer
+	r.RenderHeader(&buf, root)
+	root.Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		return r.RenderNode(&buf, node, entering)
+	})
+	r.RenderFooter(&buf, root)
+
+	return renderedMarkdown{html: buf.String(), toc: buildToc(headings), footnotes: footnotes, duplicateIDs: duplicateIDs}, nil
+}
 
-	return html
+// Remove the copies of a footnote's content that blackfriday appends to item
+// for each of the note's numRefs references but the first.
+func dedupeNoteContent(item *blackfriday.Node, numRefs int) {
+	var children []*blackfriday.Node
+	for c := item.FirstChild; c != nil; c = c.Next {
+		children = append(children, c)
+	}
+	if numRefs < 2 || len(children)%numRefs != 0 {
+		return
+	}
+	for _, c := range children[len(children)/numRefs:] {
+		c.Unlink()
+	}
+}
+
+// The plain text of node and its children.
+func blackfridayNodeText(node *blackfriday.Node) string {
+	var b strings.Builder
+	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && (n.Type == blackfriday.Text || n.Type == blackfriday.Code) {
+			b.Write(n.Literal)
+		}
+		return blackfriday.GoToNext
+	})
+	return b.String()
+}
+
+// Render the body of p with r. Shortcodes are resolved first. If p has the
+// toc flag, the body starts with the ToC. Footnotes are shown in the
+// configured style, and math is rendered to MathML if enabled for p.
+func (te *templateEngine) renderBody(r renderer, p *post) (renderedMarkdown, error) {
+	conf := te.conf
+	body, err := te.resolveShortcodes(p.Body, p)
+	if err != nil {
+		return renderedMarkdown{}, err
+	}
+	body = highlightCode(body)
+	var math []mathSpan
+	if conf.Math || p.HasMath() {
+		body, math = protectMath(body)
+	}
+
+	rendered, err := r.render(body)
+	if err != nil {
+		return rendered, fmt.Errorf("post %v: %v", p.ID, err)
+	}
+	for _, id := range rendered.duplicateIDs {
+		log.Printf("Warning: post %v: more than one heading has the id %q", p.ID, id)
+	}
+	rendered.html = placeFootnotes(rendered.html, rendered.footnotes, footnoteStyleFor(p, conf.FootnoteStyle))
+
+	var mathML, tex []string
+	if len(math) > 0 {
+		mathML, err = renderMath(math, conf.MathMacros)
+		if err != nil {
+			return rendered, fmt.Errorf("post %v: %v", p.ID, err)
+		}
+		rendered.html = replaceMathPlaceholders(rendered.html, mathML)
+		for i := range rendered.footnotes {
+			fn := &rendered.footnotes[i]
+			fn.Content = template.HTML(replaceMathPlaceholders(string(fn.Content), mathML))
+		}
+
+		tex = make([]string, len(math))
+		for i, span := range math {
+			tex[i] = "$" + span.tex + "$"
+		}
+	}
+
+	// Plain ToC titles get the TeX source of math, HTML ones the MathML
+	// like the body.
+	finishToc(rendered.toc, mathML, tex)
+	if p.ShouldGenerateToc() {
+		rendered.html = tocHTML(rendered.toc) + rendered.html
+	}
+
+	return rendered, nil
+}
+
+// The directory below OutDir for the output of CompareMarkdownEngines.
+const markdownCompareDir = "markdown-compare"
+
+// Render the body of each post with every Markdown engine, and write the
+// results to markdownCompareDir as <id>.<engine>.html for diffing. Logs the
+// posts whose output differs between the engines.
+func (s *Site) CompareMarkdownEngines() error {
+	h, err := newHighlighter(s.conf)
+	if err != nil {
+		return err
+	}
+	renderers, err := newMarkdownRenderers(s.conf, h)
+	if err != nil {
+		return err
+	}
+	engine := newTemplateEngine(renderers, s.conf)
+	engineNames := slices.Sorted(maps.Keys(renderers))
+
+	outDir := filepath.Join(s.conf.OutDir, markdownCompareDir)
+	if err := os.MkdirAll(outDir, 0o775); err != nil {
+		return err
+	}
+
+	numDiffering := 0
+	for _, p := range s.posts {
+		outputs := make([]string, 0, len(engineNames))
+		for _, name := range engineNames {
+			rendered, err := engine.renderBody(renderers[name], p)
+			if err != nil {
+				return fmt.Errorf("rendering %v with %v: %v", p.ID, name, err)
+			}
+			outFile := filepath.Join(outDir, p.ID+"."+name+".html")
+			if err := os.WriteFile(outFile, []byte(rendered.html), 0o664); err != nil {
+				return err
+			}
+			outputs = append(outputs, rendered.html)
+		}
+		if slices.ContainsFunc(outputs, func(html string) bool { return html != outputs[0] }) {
+			log.Println("Markdown engines differ for", p.ID)
+			numDiffering++
+		}
+	}
+	log.Printf("%v of %v posts differ, see %v", numDiffering, len(s.posts), outDir)
+	return nil
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wyatt915/treeblood"
+)
+
+// A $...$ or $$...$$ math span of a post, without the dollar signs.
+type mathSpan struct {
+	tex     string
+	display bool
+}
+
+// Math is replaced by these placeholders before the Markdown is rendered, so
+// that neither Markdown nor Smartypants change it. They contain nothing that
+// Markdown would treat specially.
+func mathPlaceholder(i int) string {
+	return "⟦math" + strconv.Itoa(i) + "⟧"
+}
+
+var mathPlaceholderRe = regexp.MustCompile(`⟦math(\d+)⟧`)
+
+// Replace the math in a Markdown body by placeholders, and return it
+// separately. Math in code blocks and code spans is left alone, and \$ is a
+// literal dollar sign.
+//
+// Inline math must start with a non-space after the opening $ and end with a
+// non-space before the closing $, which must not be followed by a digit. This
+// way "$5 and $10" is not math. Display math can span several lines.
+func protectMath(body []byte) ([]byte, []mathSpan) {
+	out := bytes.NewBuffer(make([]byte, 0, len(body)))
+	spans := make([]mathSpan, 0, 10)
+	addSpan := func(tex string, display bool) {
+		out.WriteString(mathPlaceholder(len(spans)))
+		spans = append(spans, mathSpan{tex: strings.TrimSpace(tex), display: display})
+	}
+
+	var fence []byte
+	// The lines of display math that isn't closed yet, if displayStart >= 0.
+	var display bytes.Buffer
+	displayStart := -1
+	prevBlank := true
+	inIndentedCode := false
+
+	for line := range bytes.Lines(body) {
+		trimmed := bytes.TrimSpace(line)
+		blank := len(trimmed) == 0
+
+		if displayStart >= 0 {
+			before, after, closed := bytes.Cut(line, []byte("$$"))
+			display.Write(before)
+			if !closed {
+				// Keep the text in case the math is never closed.
+				out.Write(line)
+				continue
+			}
+			out.Truncate(displayStart)
+			addSpan(display.String(), true)
+			displayStart = -1
+			line = after
+		}
+
+		switch {
+		case fence != nil:
+			if bytes.HasPrefix(trimmed, fence) {
+				fence = nil
+			}
+			out.Write(line)
+			continue
+		case isCodeFence(trimmed):
+			fence = trimmed[:3]
+			out.Write(line)
+			continue
+		case inIndentedCode || prevBlank:
+			inIndentedCode = isIndentedCode(line) || (inIndentedCode && blank)
+			if inIndentedCode {
+				out.Write(line)
+				prevBlank = blank
+				continue
+			}
+		}
+		prevBlank = blank
+
+		if start, ok := protectMathInLine(out, line, addSpan); !ok {
+			// The line opens display math that goes on in later lines.
+			displayStart = out.Len()
+			out.Write(line[start:])
+			display.Reset()
+			display.Write(line[start+2:])
+		}
+	}
+
+	return out.Bytes(), spans
+}
+
+// Copy line to out with its math replaced by placeholders. If the line ends
+// in unclosed display math, stops there and returns the position of its
+// opening $$ and false.
+func protectMathInLine(out *bytes.Buffer, line []byte, addSpan func(string, bool)) (int, bool) {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line) && line[i+1] == '$':
+			out.WriteByte('$')
+			i++
+			continue
+		case c == '`':
+			// Copy code spans unchanged.
+			n := 1
+			for i+n < len(line) && line[i+n] == '`' {
+				n++
+			}
+			ticks := line[i : i+n]
+			if end := bytes.Index(line[i+n:], ticks); end >= 0 {
+				out.Write(line[i : i+n+end+n])
+				i += n + end + n - 1
+			} else {
+				out.Write(ticks)
+				i += n - 1
+			}
+			continue
+		case c == '$' && i+1 < len(line) && line[i+1] == '$':
+			end := bytes.Index(line[i+2:], []byte("$$"))
+			if end < 0 {
+				return i, false
+			}
+			addSpan(string(line[i+2:i+2+end]), true)
+			i += 2 + end + 1
+			continue
+		case c == '$':
+			if end := closingDollar(line, i); end > 0 {
+				addSpan(string(line[i+1:end]), false)
+				i = end
+				continue
+			}
+		}
+		out.WriteByte(c)
+	}
+	return 0, true
+}
+
+// The position of the $ closing inline math opened at line[start], or -1.
+func closingDollar(line []byte, start int) int {
+	if start+1 >= len(line) || isSpace(line[start+1]) {
+		return -1
+	}
+	for j := start + 1; j < len(line); j++ {
+		if line[j] != '$' {
+			continue
+		}
+		if isSpace(line[j-1]) || line[j-1] == '\\' {
+			continue
+		}
+		if j+1 < len(line) && line[j+1] >= '0' && line[j+1] <= '9' {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// Render math spans to MathML, with the given macros.
+func renderMath(spans []mathSpan, macros map[string]string) ([]string, error) {
+	doc := treeblood.NewDocument(macros, false)
+	doc.PrintOneLine = true
+
+	mathML := make([]string, len(spans))
+	for i, span := range spans {
+		var err error
+		if span.display {
+			mathML[i], err = doc.DisplayStyle(span.tex)
+		} else {
+			mathML[i], err = doc.TextStyle(span.tex)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid math %q: %v", span.tex, err)
+		}
+		mathML[i] = strings.TrimSpace(mathML[i])
+	}
+	return mathML, nil
+}
+
+// Replace the math placeholders in s by the corresponding replacements.
+func replaceMathPlaceholders(s string, replacements []string) string {
+	return mathPlaceholderRe.ReplaceAllStringFunc(s, func(placeholder string) string {
+		i, _ := strconv.Atoi(mathPlaceholderRe.FindStringSubmatch(placeholder)[1])
+		if i >= len(replacements) {
+			return placeholder
+		}
+		return replacements[i]
+	})
+}
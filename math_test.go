@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProtectMath(t *testing.T) {
+	tests := []struct {
+		body, want string
+		tex        []string
+	}{
+		{"$x$ and $y$", "⟦math0⟧ and ⟦math1⟧", []string{"x", "y"}},
+		{"$5 and $10", "$5 and $10", nil},
+		{`\$x$`, `$x$`, nil},
+		// A closing $ followed by a digit doesn't close, so the search goes on.
+		{"$x$5 and $y$", "⟦math0⟧", []string{"x$5 and $y"}},
+		{"$x$5 and y", "$x$5 and y", nil},
+		{"`$x$`", "`$x$`", nil},
+	}
+	for _, test := range tests {
+		got, spans := protectMath([]byte(test.body))
+		if string(got) != test.want {
+			t.Errorf("%q: got %q, want %q", test.body, got, test.want)
+		}
+		var tex []string
+		for _, s := range spans {
+			tex = append(tex, s.tex)
+		}
+		if strings.Join(tex, "|") != strings.Join(test.tex, "|") {
+			t.Errorf("%q: got math %q, want %q", test.body, tex, test.tex)
+		}
+	}
+}
+
+func TestMathInToc(t *testing.T) {
+	conf := &SiteConf{Math: true}
+	renderers, err := newMarkdownRenderers(conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	te := newTemplateEngine(renderers, conf)
+	p := &post{ID: "test", Flags: []string{"toc"}, Body: []byte("# Area $a^2$\n\nText.\n")}
+
+	for _, engine := range []string{blackfridayEngine, goldmarkEngine} {
+		rendered, err := te.renderBody(renderers[engine], p)
+		if err != nil {
+			t.Fatalf("%v: %v", engine, err)
+		}
+		if len(rendered.toc) != 1 {
+			t.Fatalf("%v: got %d ToC entries, want 1", engine, len(rendered.toc))
+		}
+		e := rendered.toc[0]
+		if e.Title != "Area $a^2$" {
+			t.Errorf("%v: title %q, want the TeX source", engine, e.Title)
+		}
+		if !strings.HasPrefix(string(e.TitleHTML), "Area <math") {
+			t.Errorf("%v: HTML title %q, want MathML", engine, e.TitleHTML)
+		}
+		if !strings.Contains(rendered.html, string(e.TitleHTML)+"</a>") {
+			t.Errorf("%v: the ToC doesn't show the HTML title:\n%v", engine, rendered.html)
+		}
+	}
+}
@@ -3,16 +3,38 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"slices"
 	"time"
 )
 
 type post struct {
 	Title, ID, Blurb string
 	Date             time.Time
+	Updated          time.Time // Zero unless set in the header
 	Path             string
 	Flags            []string
 	Body             []byte
-	Categories       []category
+	// The line of the post file that Body starts on, counting from 1.
+	bodyLine int
+	// The post's terms of each taxonomy, by taxonomy name.
+	Terms       map[string][]category
+	Authors     []string // Keys into SiteConf.Authors
+	Series      string
+	SeriesOrder int // Position within the series, zero if not set
+	// The Markdown engine for this post, if not the site's default.
+	MarkdownEngine string
+	// The id of the post's feed entries from the id header, if it should
+	// not be generated.
+	FeedID string
+	// The template for this post in layoutsDir, without ".html", from the
+	// layout header. Empty to choose one by flags, see
+	// templateEngine.layoutFor.
+	Layout string
+}
+
+// The terms of the "categories" taxonomy.
+func (p *post) Categories() []category {
+	return p.Terms["categories"]
 }
 
 func (p *post) IsStatic() bool {
@@ -27,6 +49,22 @@ func (p *post) ShouldGenerateToc() bool {
 	return p.hasFlag("toc")
 }
 
+func (p *post) HasMath() bool {
+	return p.hasFlag("math")
+}
+
+// Whether the post goes into the feeds. Static pages and posts with the
+// nofeed flag don't.
+func (p *post) IsInFeeds() bool {
+	return !p.IsStatic() && !p.hasFlag("nofeed")
+}
+
+// Whether search engines should know about the post. Drafts and posts with
+// the noindex flag are left out of the sitemap.
+func (p *post) IsIndexable() bool {
+	return !p.IsDraft() && !p.hasFlag("noindex")
+}
+
 func (p *post) hasFlag(flag string) bool {
 	for _, f := range p.Flags {
 		if f == flag {
@@ -36,6 +74,14 @@ func (p *post) hasFlag(flag string) bool {
 	return false
 }
 
+// The date of the last change to the post: Updated if set, else Date.
+func (p *post) LastModified() time.Time {
+	if p.Updated.After(p.Date) {
+		return p.Updated
+	}
+	return p.Date
+}
+
 // Called from templates
 func (p *post) FormatDateShort() string {
 	return formatDateShort(p.Date)
@@ -49,8 +95,8 @@ func (p *post) String() string {
 	b.WriteString(p.Date.String())
 	b.WriteString("\nblurb: ")
 	b.WriteString(p.Blurb)
-	b.WriteString("\ncategories: ")
-	fmt.Fprintln(b, p.Categories)
+	b.WriteString("\nterms: ")
+	fmt.Fprintln(b, p.Terms)
 
 	body := p.Body
 	if len(body) > 200 {
@@ -94,3 +140,30 @@ func (ps posts) pruneOlderThan(minDate time.Time) posts {
 	}
 	return pruned
 }
+
+// Find the posts before and after p in ps, which is sorted newest first like
+// Site.posts. prev is the next older post and next the next newer one. Static
+// pages are skipped, and have no neighbours themselves.
+func (ps posts) neighbours(p *post) (prev, next *post) {
+	if p.IsStatic() {
+		return nil, nil
+	}
+
+	i := slices.Index(ps, p)
+	if i == -1 {
+		return nil, nil
+	}
+	for _, older := range ps[i+1:] {
+		if !older.IsStatic() {
+			prev = older
+			break
+		}
+	}
+	for j := i - 1; j >= 0; j-- {
+		if !ps[j].IsStatic() {
+			next = ps[j]
+			break
+		}
+	}
+	return prev, next
+}
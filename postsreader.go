@@ -5,9 +5,32 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// Accepted layouts for the date and updated header fields, tried in order.
+// Dates without a timezone are UTC, like the file name date stamps.
+var headerDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+func parseHeaderDate(s string) (time.Time, error) {
+	for _, layout := range headerDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
 func findPostFiles(dir, fileExtension string) ([]string, error) {
 	files := make([]string, 0, 100)
 
@@ -27,7 +50,14 @@ func findPostFiles(dir, fileExtension string) ([]string, error) {
 	return files, err
 }
 
-func readPostFromFile(path, dateStampFormat string) (*post, error) {
+// A header field of a post. Fields from the legacy header format have a
+// single value, front matter fields can have several.
+type headerField struct {
+	key  string
+	vals []string
+}
+
+func readPostFromFile(path string, conf *SiteConf) (*post, error) {
 	fileBaseName := filepath.Base(path)
 	fileBaseName = fileBaseName[:len(fileBaseName)-len(filepath.Ext(fileBaseName))]
 
@@ -36,51 +66,131 @@ func readPostFromFile(path, dateStampFormat string) (*post, error) {
 		return nil, err
 	}
 
+	fields, body, ok, err := parseFrontMatter(fileContent)
+	if err != nil {
+		return nil, fmt.Errorf("invalid front matter in article %v: %v", path, err)
+	}
+	if !ok {
+		fields, body, err = parseLegacyHeader(fileContent, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a := &post{
+		ID:       fileBaseName,
+		Path:     path,
+		Body:     body,
+		bodyLine: lineAt(fileContent, len(fileContent)-len(body)),
+		Terms:    make(map[string][]category),
+	}
+
+	for _, f := range fields {
+		if t := conf.taxonomyForHeader(f.key); t != nil {
+			for _, term := range splitListValues(f.vals) {
+				a.Terms[t.Name] = append(a.Terms[t.Name], category(term))
+			}
+			continue
+		}
+
+		known, err := a.setHeaderField(f.key, f.vals)
+		if err != nil {
+			return nil, fmt.Errorf("invalid header field %v in article %v: %v", f.key, path, err)
+		}
+		if !known {
+			fmt.Printf("  Skipping unknown header field %s in article %v\n", f.key, fileBaseName)
+		}
+	}
+
+	// Without a date header, the date comes from the file name.
+	if a.Date.IsZero() && !a.IsStatic() {
+		date, err := extractDateFromFilename(fileBaseName, conf.WritingFileDateStampFormat)
+		if err != nil {
+			return nil, err
+		}
+		a.Date = *date
+	}
+
+	return a, nil
+}
+
+// Parse the original header format: "key: value" lines up to the first empty
+// line.
+func parseLegacyHeader(fileContent []byte, path string) ([]headerField, []byte, error) {
 	firstEmptyLine := bytes.Index(fileContent, []byte("\n\n"))
 	if firstEmptyLine == -1 {
 		firstEmptyLine = bytes.Index(fileContent, []byte("\r\n\r\n"))
 
 		if firstEmptyLine == -1 {
-			return nil, fmt.Errorf("weird article %v: no empty line", path)
+			return nil, nil, fmt.Errorf("weird article %v: no empty line", path)
 		}
 	}
 
-	a := &post{
-		ID:         fileBaseName,
-		Body:       fileContent[firstEmptyLine+2:],
-		Categories: make([]category, 0, 5),
-	}
-
 	headerLines := bytes.Split(fileContent[:firstEmptyLine], []byte("\n"))
+	fields := make([]headerField, 0, len(headerLines))
 	for _, l := range headerLines {
 		if colon := bytes.Index(l, []byte(":")); colon != -1 {
 			key, val := l[:colon], bytes.TrimSpace(l[colon+1:])
-			switch string(key) {
-			case "title":
-				a.Title = string(val)
-			case "blurb":
-				a.Blurb = string(val)
-			case "categories":
-				for _, c := range bytes.Split(val, []byte(",")) {
-					a.Categories = append(a.Categories, category(string(bytes.TrimSpace(c))))
-				}
-			case "flags":
-				a.Flags = strings.Split(string(val), ",")
-			default:
-				fmt.Printf("  Skipping unknown header field %s in article %v\n", key, fileBaseName)
-			}
+			fields = append(fields, headerField{key: string(key), vals: []string{string(val)}})
 		} else {
-			return nil, fmt.Errorf("invalid header line in article %v: %s", path, l)
+			return nil, nil, fmt.Errorf("invalid header line in article %v: %s", path, l)
 		}
 	}
 
-	if !a.IsStatic() {
-		date, err := extractDateFromFilename(fileBaseName, dateStampFormat)
-		if err != nil {
-			return nil, err
+	return fields, fileContent[firstEmptyLine+2:], nil
+}
+
+// Set the post field for header key. Returns false if the key is unknown.
+func (a *post) setHeaderField(key string, vals []string) (bool, error) {
+	var err error
+	switch key {
+	case "title":
+		a.Title = strings.Join(vals, " ")
+	case "blurb":
+		a.Blurb = strings.Join(vals, " ")
+	case "author", "authors":
+		a.Authors = append(a.Authors, splitListValues(vals)...)
+	case "series":
+		a.Series = strings.Join(vals, " ")
+	case "series_order":
+		a.SeriesOrder, err = strconv.Atoi(strings.Join(vals, " "))
+	case "markdown":
+		a.MarkdownEngine = strings.Join(vals, " ")
+	case "id":
+		a.FeedID = strings.Join(vals, " ")
+	case "layout":
+		a.Layout = strings.Join(vals, " ")
+	case "flags":
+		a.Flags = append(a.Flags, splitListValues(vals)...)
+	case "draft":
+		// As in front matter migrated from other generators, the same as
+		// the draft flag.
+		var draft bool
+		draft, err = strconv.ParseBool(strings.Join(vals, " "))
+		if draft && !a.IsDraft() {
+			a.Flags = append(a.Flags, "draft")
 		}
-		a.Date = *date
+	case "date":
+		a.Date, err = parseHeaderDate(strings.Join(vals, " "))
+	case "updated":
+		a.Updated, err = parseHeaderDate(strings.Join(vals, " "))
+	default:
+		return false, nil
 	}
+	return true, err
+}
 
-	return a, nil
+// Split comma-separated header values into a flat list of trimmed, non-empty
+// items. This way "tags: a, b" works in all header formats, as does a
+// YAML or TOML list.
+func splitListValues(vals []string) []string {
+	items := make([]string, 0, len(vals))
+	for _, v := range vals {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
 }
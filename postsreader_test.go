@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDraftHeader(t *testing.T) {
+	conf := &SiteConf{WritingFileDateStampFormat: "2006-01-02", Taxonomies: []TaxonomyConf{defaultTaxonomy("categories")}}
+	conf.Taxonomies[0].populateDefaults()
+	tests := []struct {
+		header string
+		draft  bool
+	}{
+		{"---\ntitle: A\ndraft: true\n---\n", true},
+		{"---\ntitle: A\ndraft: false\n---\n", false},
+		{"---\ntitle: A\ndraft: true\nflags: [draft, toc]\n---\n", true},
+		{"+++\ntitle = \"A\"\ndraft = true\n+++\n", true},
+		{"title: A\ndraft: true\n\n", true},
+		{"title: A\n\n", false},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "2024-01-31-a.md")
+		if err := os.WriteFile(path, []byte(test.header+"Text.\n"), 0o664); err != nil {
+			t.Fatal(err)
+		}
+		p, err := readPostFromFile(path, conf)
+		if err != nil {
+			t.Errorf("%q: %v", test.header, err)
+			continue
+		}
+		if p.IsDraft() != test.draft {
+			t.Errorf("%q: draft is %v, want %v", test.header, p.IsDraft(), test.draft)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "2024-01-31-a.md")
+	if err := os.WriteFile(path, []byte("---\ndraft: maybe\n---\nText.\n"), 0o664); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readPostFromFile(path, conf); err == nil {
+		t.Error("draft: maybe is accepted")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Words shorter than this are left out of the content similarity. They are
+// mostly stop words and markup remnants.
+const minRelatedWordLen = 3
+
+// One term of a post's TF-IDF vector.
+type termWeight struct {
+	term   string
+	weight float64
+}
+
+// A TF-IDF vector, sorted by term so that computing with it doesn't depend on
+// map iteration order and rebuilds give the same result.
+type termVector []termWeight
+
+func (v termVector) norm() float64 {
+	sum := 0.0
+	for _, tw := range v {
+		sum += tw.weight * tw.weight
+	}
+	return math.Sqrt(sum)
+}
+
+func (v termVector) dot(o termVector) float64 {
+	sum := 0.0
+	for i, j := 0, 0; i < len(v) && j < len(o); {
+		switch c := strings.Compare(v[i].term, o[j].term); {
+		case c < 0:
+			i++
+		case c > 0:
+			j++
+		default:
+			sum += v[i].weight * o[j].weight
+			i++
+			j++
+		}
+	}
+	return sum
+}
+
+func cosineSimilarity(a, b termVector) float64 {
+	na, nb := a.norm(), b.norm()
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return a.dot(b) / (na * nb)
+}
+
+// Lowercased words of the body, for the content similarity.
+func words(body []byte) []string {
+	fields := strings.FieldsFunc(string(body), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	ws := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if len([]rune(f)) >= minRelatedWordLen {
+			ws = append(ws, strings.ToLower(f))
+		}
+	}
+	return ws
+}
+
+// Compute the TF-IDF vectors of the bodies of ps, in the same order.
+func tfidfVectors(ps posts) []termVector {
+	termCounts := make([]map[string]int, len(ps))
+	docFreq := make(map[string]int)
+	for i, p := range ps {
+		counts := make(map[string]int)
+		for _, w := range words(p.Body) {
+			counts[w]++
+		}
+		for w := range counts {
+			docFreq[w]++
+		}
+		termCounts[i] = counts
+	}
+
+	vectors := make([]termVector, len(ps))
+	numDocs := float64(len(ps))
+	for i, counts := range termCounts {
+		total := 0
+		for _, n := range counts {
+			total += n
+		}
+		v := make(termVector, 0, len(counts))
+		for w, n := range counts {
+			idf := math.Log(numDocs / float64(docFreq[w]))
+			if idf > 0 {
+				v = append(v, termWeight{w, float64(n) / float64(total) * idf})
+			}
+		}
+		slices.SortFunc(v, func(a, b termWeight) int { return strings.Compare(a.term, b.term) })
+		vectors[i] = v
+	}
+	return vectors
+}
+
+// The Jaccard index of the categories of a and b.
+func sharedCategoriesSimilarity(a, b *post) float64 {
+	ca, cb := a.Categories(), b.Categories()
+	if len(ca) == 0 || len(cb) == 0 {
+		return 0
+	}
+	shared := 0
+	for _, c := range ca {
+		if slices.Contains(cb, c) {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ca)+len(cb)-shared)
+}
+
+type scoredPost struct {
+	post  *post
+	score float64
+}
+
+// Find the NumRelatedPosts most related posts for each post, scored by
+// shared categories and TF-IDF similarity of the bodies, weighted as
+// configured. Posts with nothing in common are never related. Static pages
+// neither have related posts nor are related to others.
+func (s *Site) relatedPosts() map[*post]posts {
+	related := make(map[*post]posts)
+	n := s.conf.NumRelatedPosts
+	if n <= 0 {
+		return related
+	}
+
+	candidates := make(posts, 0, len(s.posts))
+	for _, p := range s.posts {
+		if !p.IsStatic() {
+			candidates = append(candidates, p)
+		}
+	}
+	vectors := tfidfVectors(candidates)
+
+	for i, p := range candidates {
+		scored := make([]scoredPost, 0, len(candidates))
+		for j, other := range candidates {
+			if i == j {
+				continue
+			}
+			score := s.conf.RelatedCategoriesWeight*sharedCategoriesSimilarity(p, other) +
+				s.conf.RelatedContentWeight*cosineSimilarity(vectors[i], vectors[j])
+			if score > 0 {
+				scored = append(scored, scoredPost{other, score})
+			}
+		}
+
+		// Highest score first. Ties go to the newer post, then by ID, so
+		// that the order is stable across rebuilds.
+		slices.SortFunc(scored, func(a, b scoredPost) int {
+			if c := cmp.Compare(b.score, a.score); c != 0 {
+				return c
+			}
+			if c := b.post.Date.Compare(a.post.Date); c != 0 {
+				return c
+			}
+			return strings.Compare(a.post.ID, b.post.ID)
+		})
+
+		top := make(posts, 0, n)
+		for _, sp := range scored[:min(n, len(scored))] {
+			top = append(top, sp.post)
+		}
+		related[p] = top
+	}
+	return related
+}
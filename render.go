@@ -1,12 +1,12 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"fmt"
 	"html/template"
 	"io"
-	"log"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -15,123 +15,249 @@ func formatDateShort(d time.Time) string {
 }
 
 type templateParam struct {
+	SiteTitle          string
+	BaseURL            string
 	PageTitle          string
 	FrequentCategories []category
 	// A short id such as a category name or "About"
 	FileId string
 	FeedId string
+	// The feeds for the page, e.g. of its category, one per feed format.
+	Feeds []feedLink
+	// The stylesheet for highlighted code, empty if it uses inline styles.
+	HighlightCSSURL string
+	// Relative to BaseURL.
+	categoriesDir string
 }
 
 func (t templateParam) IdIs(id string) bool {
 	return t.FileId == id
 }
 
+// The URL of the page's feed in the first of SiteConf.FeedFormats.
+func (t templateParam) FeedURL() string {
+	if len(t.Feeds) == 0 {
+		return ""
+	}
+	return t.Feeds[0].URL
+}
+
+// The URL of the list page of category c.
+func (t templateParam) CategoryURL(c category) string {
+	return t.BaseURL + t.categoriesDir + "/" + c.Id() + ".html"
+}
+
 type postTemplateParam struct {
 	templateParam
 	*post
 	RenderedBody template.HTML
+	// The headings of the post, whether or not it has the toc flag.
+	Toc         []TocEntry
+	Footnotes   []Footnote
+	PostAuthors []author
+	// Nil if the post is not part of a series.
+	SeriesNav *seriesNav
+	// The chronological neighbours of the post, skipping static pages. Prev
+	// is older, next is newer. Nil or missing from the map if there is none.
+	PrevPost, NextPost             *post
+	PrevInCategory, NextInCategory map[category]*post
+	// The posts most related to this one, most related first.
+	RelatedPosts posts
+}
+
+// Position of a list page within a paginated listing. Unpaginated listings
+// are a single page 1 of 1 without prev/next URLs.
+type pageInfo struct {
+	PageNum, TotalPages      int
+	PrevPageURL, NextPageURL string
 }
 
 type postListTemplateParam struct {
 	templateParam
+	pageInfo
 	PageHeading    string
 	Posts          []*post
 	ShowTopicsLink bool
+	// Set on author pages.
+	Author *author
 }
 
 type topicsTemplateParam struct {
 	templateParam
+	// The name of the taxonomy, e.g. "categories".
+	Taxonomy        string
 	PostsByCategory postsByCategory
+	taxonomy        *TaxonomyConf
+}
+
+// The URL of the list page of term c of the taxonomy.
+func (t topicsTemplateParam) TermURL(c category) string {
+	return t.BaseURL + t.taxonomy.termPath(c) + ".html"
+}
+
+type seriesTemplateParam struct {
+	templateParam
+	Series *series
+}
+
+// Parameters for archive.html. The overview page has all Years and no Posts,
+// a year page has only its own year and its Posts, a month page only Posts.
+type archiveTemplateParam struct {
+	templateParam
+	PageHeading string
+	Years       []archiveYear
+	Posts       []*post
 }
 
 func (t topicsTemplateParam) Eq(a, b int) bool {
 	return a == b
 }
 
+// Markdown rendered to HTML. Footnote references in html are placeholders,
+// see placeFootnotes.
+type renderedMarkdown struct {
+	html      string
+	toc       []TocEntry
+	footnotes []Footnote
+	// Heading ids that the author gave more than one heading.
+	duplicateIDs []string
+}
+
 type renderer interface {
-	render(in []byte, generateToc bool) string
+	render(in []byte) (renderedMarkdown, error)
 }
 
 type templateEngine struct {
-	toHtml        renderer
+	// The Markdown renderers by engine name.
+	renderers     map[string]renderer
+	conf          *SiteConf
 	templateDir   string
 	templateCache map[string]*template.Template
+	funcs         template.FuncMap
 }
 
-func newTemplateEngine(r renderer, dir string) templateEngine {
+func newTemplateEngine(renderers map[string]renderer, conf *SiteConf) templateEngine {
 	return templateEngine{
-		toHtml:        r,
-		templateDir:   dir,
+		renderers:     renderers,
+		conf:          conf,
+		templateDir:   conf.TemplateDir,
 		templateCache: make(map[string]*template.Template),
+		funcs:         newTemplateFuncs(renderers, conf),
 	}
 }
 
-func (te *templateEngine) renderPost(tp templateParam, a *post, w io.Writer) (string, error) {
-	body := highlightCode(a.Body)
+// The Markdown renderer for p, named in its markdown header or the default.
+func (te *templateEngine) rendererFor(p *post) (renderer, error) {
+	name := te.conf.MarkdownEngine
+	if len(p.MarkdownEngine) > 0 {
+		name = p.MarkdownEngine
+	}
+	r, ok := te.renderers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown Markdown engine %q for post %v", name, p.ID)
+	}
+	return r, nil
+}
 
-	renderedBody := template.HTML(te.toHtml.render(body, a.ShouldGenerateToc()))
-	p := postTemplateParam{
-		templateParam: tp,
-		post:          a,
-		RenderedBody:  renderedBody,
+// Render the post p.post with the other fields of p already set. Returns the
+// rendered body.
+func (te *templateEngine) renderPost(p postTemplateParam, w io.Writer) (string, error) {
+	toHtml, err := te.rendererFor(p.post)
+	if err != nil {
+		return "", err
+	}
+	rendered, err := te.renderBody(toHtml, p.post)
+	if err != nil {
+		return "", err
 	}
+	p.RenderedBody = template.HTML(rendered.html)
+	p.Toc = rendered.toc
+	p.Footnotes = rendered.footnotes
 
-	t := te.getTemplate("post.html")
-	return string(renderedBody), t.Execute(w, p)
+	layout, err := te.layoutFor(p.post)
+	if err != nil {
+		return "", err
+	}
+	if err := te.execute(layout, w, p); err != nil {
+		return "", fmt.Errorf("post %v, layout %v: %v", p.ID, layout, err)
+	}
+	return string(p.RenderedBody), nil
 }
 
-func (te *templateEngine) renderPostList(tp templateParam, posts []*post, showTopicsLink bool, pageHeading string, w io.Writer) error {
-	p := postListTemplateParam{
-		templateParam:  tp,
-		PageHeading:    pageHeading,
-		Posts:          posts,
-		ShowTopicsLink: showTopicsLink,
+// The subdirectory of TemplateDir with the post layouts. Only templates in
+// it can be chosen, so that posts don't get the templates of other pages.
+const layoutsDir = "layouts"
+
+// The template file for p: the one in layoutsDir named in its layout header,
+// else the first one there named after one of its flags, such as
+// layouts/static.html, else post.html.
+func (te *templateEngine) layoutFor(p *post) (string, error) {
+	if len(p.Layout) > 0 {
+		layout := path.Join(layoutsDir, p.Layout+".html")
+		if !filepath.IsLocal(p.Layout) || strings.ContainsAny(p.Layout, `/\`) || !te.templateExists(layout) {
+			return "", fmt.Errorf("post %v: unknown layout %q, there is no template %v", p.ID, p.Layout, layout)
+		}
+		return layout, nil
 	}
-	t := te.getTemplate("list.html")
-	return t.Execute(w, p)
+	for _, flag := range p.Flags {
+		layout := path.Join(layoutsDir, flag+".html")
+		if filepath.IsLocal(flag) && !strings.ContainsAny(flag, `/\`) && te.templateExists(layout) {
+			return layout, nil
+		}
+	}
+	return "post.html", nil
+}
+
+func (te *templateEngine) renderPostList(p postListTemplateParam, w io.Writer) error {
+	return te.execute("list.html", w, p)
 }
 
-func (te *templateEngine) renderTopics(tp templateParam, topics postsByCategory, w io.Writer) error {
+func (te *templateEngine) renderTopics(tp templateParam, taxonomy *TaxonomyConf, topics postsByCategory, w io.Writer) error {
 	p := topicsTemplateParam{
 		templateParam:   tp,
+		Taxonomy:        taxonomy.Name,
 		PostsByCategory: topics,
+		taxonomy:        taxonomy,
 	}
-	t := te.getTemplate("topics.html")
-	return t.Execute(w, p)
+	return te.execute("topics.html", w, p)
 }
 
-func (te *templateEngine) getTemplate(filename string) *template.Template {
-	t, ok := te.templateCache[filename]
-	if !ok {
-		t = template.Must(template.ParseFiles(
-			filepath.Join(te.templateDir, "global.html"),
-			filepath.Join(te.templateDir, filename)))
-		te.templateCache[filename] = t
+func (te *templateEngine) renderSeries(tp templateParam, ser *series, w io.Writer) error {
+	p := seriesTemplateParam{
+		templateParam: tp,
+		Series:        ser,
 	}
-	return t
+	return te.execute("series.html", w, p)
 }
 
-// For now, just strip the highlighting directives.
-func highlightCode(text []byte) []byte {
-	newText := bytes.NewBuffer(make([]byte, 0, len(text)))
-	r := bufio.NewReader(bytes.NewReader(text))
-
-	for {
-		line, err := r.ReadBytes('\n')
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Fatal(err)
-		}
+func (te *templateEngine) renderArchive(tp templateParam, pageHeading string, years []archiveYear, posts []*post, w io.Writer) error {
+	p := archiveTemplateParam{
+		templateParam: tp,
+		PageHeading:   pageHeading,
+		Years:         years,
+		Posts:         posts,
+	}
+	return te.execute("archive.html", w, p)
+}
 
-		if !bytes.HasPrefix(bytes.TrimSpace(line), []byte("!highlight")) {
-			_, err = newText.Write(line)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
+// The page template filename, with global.html. Parse errors name the file
+// and line.
+func (te *templateEngine) getTemplate(filename string) (*template.Template, error) {
+	if t, ok := te.templateCache[filename]; ok {
+		return t, nil
+	}
+	t, err := te.parseTemplateFiles("global.html", filename)
+	if err != nil {
+		return nil, err
 	}
+	te.templateCache[filename] = t
+	return t, nil
+}
 
-	return newText.Bytes()
+func (te *templateEngine) execute(filename string, w io.Writer, p any) error {
+	t, err := te.getTemplate(filename)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, p)
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLayoutFor(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, layoutsDir), 0o775); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"essay.html", "static.html"} {
+		if err := os.WriteFile(filepath.Join(dir, layoutsDir, name), []byte(`{{template "global" .}}`), 0o664); err != nil {
+			t.Fatal(err)
+		}
+	}
+	te := newTemplateEngine(nil, &SiteConf{TemplateDir: dir})
+
+	tests := []struct {
+		p    post
+		want string
+	}{
+		{post{}, "post.html"},
+		{post{Layout: "essay"}, "layouts/essay.html"},
+		{post{Flags: []string{"toc", "static"}}, "layouts/static.html"},
+		{post{Layout: "essay", Flags: []string{"static"}}, "layouts/essay.html"},
+		// Templates of other pages are not layouts.
+		{post{Flags: []string{"list"}}, "post.html"},
+		{post{Flags: []string{"../global"}}, "post.html"},
+	}
+	for _, test := range tests {
+		got, err := te.layoutFor(&test.p)
+		if err != nil {
+			t.Errorf("%+v: %v", test.p, err)
+		} else if got != test.want {
+			t.Errorf("%+v: got %v, want %v", test.p, got, test.want)
+		}
+	}
+
+	for _, layout := range []string{"list", "global", "topics", "../post", "missing"} {
+		_, err := te.layoutFor(&post{ID: "test", Layout: layout})
+		if err == nil || !strings.Contains(err.Error(), "unknown layout") {
+			t.Errorf("layout %v: got error %v, want unknown layout", layout, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+// RSS 2.0, see https://www.rssboard.org/rss-specification. The feed is made
+// from the Atom feed, so that both have the same entries. Since RSS wants
+// email addresses for authors, their names go to the Dublin Core creator
+// element instead, and the full content goes to content:encoded.
+
+const (
+	rssContentNS = "http://purl.org/rss/1.0/modules/content/"
+	rssDCNS      = "http://purl.org/dc/elements/1.1/"
+)
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssCDATA struct {
+	Text string `xml:",cdata"`
+}
+
+type rssItem struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	GUID        rssGUID   `xml:"guid"`
+	PubDate     string    `xml:"pubDate,omitempty"`
+	Creators    []string  `xml:"dc:creator"`
+	Categories  []string  `xml:"category"`
+	Description *rssCDATA `xml:"description"`
+	Content     *rssCDATA `xml:"content:encoded"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	Items         []*rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	DCNS      string     `xml:"xmlns:dc,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+// Atom's RFC 3339 dates in the RFC 822 format of RSS.
+func rssDate(atomDate string) string {
+	t, err := time.Parse(time.RFC3339, atomDate)
+	if err != nil {
+		return ""
+	}
+	return t.Format(time.RFC1123Z)
+}
+
+func rssFromAtom(f *atomFeed) *rssFeed {
+	feed := &rssFeed{
+		Version:   "2.0",
+		ContentNS: rssContentNS,
+		DCNS:      rssDCNS,
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link.Href,
+			Description:   f.Title,
+			LastBuildDate: rssDate(f.Updated),
+		},
+	}
+
+	for _, e := range f.Entries {
+		item := &rssItem{
+			Title:   e.Title,
+			Link:    e.Link.Href,
+			GUID:    rssGUID{Value: e.ID},
+			PubDate: rssDate(e.Published),
+		}
+		authors := e.Authors
+		if len(authors) == 0 {
+			authors = f.Authors
+		}
+		for _, a := range authors {
+			item.Creators = append(item.Creators, a.Name)
+		}
+		for _, c := range e.Categories {
+			item.Categories = append(item.Categories, c.Term)
+		}
+		// Readers show the description, so it's the full content unless
+		// there is a summary.
+		if e.Summary != nil {
+			item.Description = &rssCDATA{e.Summary.html()}
+		}
+		if e.Content != nil {
+			item.Content = &rssCDATA{e.Content.Body}
+			if item.Description == nil {
+				item.Description = &rssCDATA{e.Content.Body}
+			}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return feed
+}
+
+func (f *rssFeed) genXML() ([]byte, error) {
+	data, err := xml.MarshalIndent(f, " ", " ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(strings.TrimSuffix(xml.Header, "\n")), data...), nil
+}
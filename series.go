@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The parts of a series of posts, in reading order.
+type series struct {
+	Name string
+	// The series index page.
+	URL   string
+	Parts posts
+}
+
+func (s *series) Id() string { return strings.ReplaceAll(s.Name, " ", "_") }
+
+// A post's place in its series.
+type seriesNav struct {
+	*series
+	// Starts at 1.
+	PartNum            int
+	PrevPart, NextPart *post
+}
+
+func (n seriesNav) TotalParts() int { return len(n.Parts) }
+
+// Order series parts by series_order, then by date. Parts without an order
+// come after those with one.
+func compareSeriesParts(a, b *post) int {
+	if (a.SeriesOrder == 0) != (b.SeriesOrder == 0) {
+		if a.SeriesOrder == 0 {
+			return 1
+		}
+		return -1
+	}
+	if c := cmp.Compare(a.SeriesOrder, b.SeriesOrder); c != 0 {
+		return c
+	}
+	if c := a.Date.Compare(b.Date); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// Collect the series that posts belong to, ordered by name.
+func (s *Site) groupBySeries(ps posts) []*series {
+	bySeries := make([]*series, 0, 10)
+
+	for _, p := range ps {
+		if len(p.Series) == 0 {
+			continue
+		}
+		i := slices.IndexFunc(bySeries, func(ser *series) bool { return ser.Name == p.Series })
+		if i == -1 {
+			bySeries = append(bySeries, &series{Name: p.Series})
+			i = len(bySeries) - 1
+		}
+		bySeries[i].Parts = append(bySeries[i].Parts, p)
+	}
+
+	for _, ser := range bySeries {
+		ser.URL = s.conf.BaseURL + s.conf.SeriesOutDir + "/" + ser.Id() + ".html"
+		slices.SortFunc(ser.Parts, compareSeriesParts)
+	}
+	slices.SortFunc(bySeries, func(a, b *series) int { return strings.Compare(a.Name, b.Name) })
+	return bySeries
+}
+
+// Find the position of p in its series, or nil if it isn't part of one.
+func navInSeries(allSeries []*series, p *post) *seriesNav {
+	for _, ser := range allSeries {
+		if ser.Name != p.Series {
+			continue
+		}
+		i := slices.Index(ser.Parts, p)
+		nav := &seriesNav{series: ser, PartNum: i + 1}
+		if i > 0 {
+			nav.PrevPart = ser.Parts[i-1]
+		}
+		if i < len(ser.Parts)-1 {
+			nav.NextPart = ser.Parts[i+1]
+		}
+		return nav
+	}
+	return nil
+}
+
+// Render an index page for each series under SeriesOutDir.
+func (s *Site) renderSeriesPages(allSeries []*series, tp templateParam, engine templateEngine) error {
+	if len(allSeries) == 0 {
+		return nil
+	}
+
+	seriesDir := filepath.Join(s.conf.OutDir, s.conf.SeriesOutDir)
+	if err := os.MkdirAll(seriesDir, 0o775); err != nil {
+		return err
+	}
+
+	for _, ser := range allSeries {
+		var b bytes.Buffer
+		tp.PageTitle = ser.Name
+		tp.FeedId = "index"
+		tp.Feeds = s.feedLinks("index")
+		tp.FileId = ser.Id()
+		if err := engine.renderSeries(tp, ser, &b); err != nil {
+			return err
+		}
+		outHtmlName := filepath.Join(seriesDir, ser.Id()+".html")
+		if err := os.WriteFile(outHtmlName, b.Bytes(), 0o664); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The outcome of the last render in watch and serve mode.
+type buildStatus struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (s *buildStatus) set(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *buildStatus) get() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func serveSite(dir string, status *buildStatus) {
+	port := ":9999"
+
+	http.Handle("/", errorOverlayHandler(dir, status, http.FileServer(http.Dir(dir))))
+	log.Printf("Serving %v on %v.", dir, port)
+	log.Fatal(http.ListenAndServe(port, nil))
+}
+
+// Serve HTML pages with an overlay showing the error of the last render, if
+// it failed. Everything else, and all requests while the site is fine, go to
+// next.
+func errorOverlayHandler(dir string, status *buildStatus, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := status.get()
+		name := path.Clean("/" + r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			name = path.Join(name, "index.html")
+		}
+		if err == nil || path.Ext(name) != ".html" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		page, readErr := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if readErr != nil {
+			page = []byte("<!DOCTYPE html>\n<html><body></body></html>\n")
+		}
+		overlay := fmt.Sprintf(errorOverlay, html.EscapeString(err.Error()))
+		if i := bytes.LastIndex(page, []byte("</body>")); i >= 0 {
+			page = append(page[:i], append([]byte(overlay), page[i:]...)...)
+		} else {
+			page = append(page, overlay...)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(page)
+	})
+}
+
+const errorOverlay = `
+<div style="position: fixed; inset: 0; z-index: 2147483647; overflow: auto; padding: 2rem; background: rgba(20, 20, 20, 0.92); color: #f4f4f4; font: 14px/1.5 monospace;">
+<h1 style="color: #ff6b6b; font: bold 1.3rem sans-serif;">The site failed to render</h1>
+<p style="font-family: sans-serif;">This is the last good version of the page. It is updated once the error is fixed.</p>
+<pre style="white-space: pre-wrap;">%s</pre>
+</div>
+`
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The subdirectory of TemplateDir with the shortcode templates.
+const shortcodesDir = "shortcodes"
+
+// A shortcode tag in a post body: {{< name key="value" >}}, the closing
+// {{< /name >}}, or the self-closing {{< name />}}. {{</* name */>}} is
+// the literal text of the tag.
+var shortcodeTagRe = regexp.MustCompile(`\{\{<\s*(/\*)?\s*(/?)([\w-]+)((?:\s+[\w-]+=(?:"(?:[^"\\]|\\.)*"|[^\s"/>]+))*)\s*(/?)\s*(\*/)?\s*>\}\}`)
+
+var shortcodeArgRe = regexp.MustCompile(`([\w-]+)=("(?:[^"\\]|\\.)*"|[^\s"/>]+)`)
+
+// The parameter of shortcode templates.
+type shortcodeParam struct {
+	Name string
+	Args map[string]string
+	// The text between the opening and closing tag, with the shortcodes in
+	// it resolved. Empty for shortcodes without closing tag.
+	Inner template.HTML
+	Post  *post
+}
+
+// Returns the named argument, or "" if it's not given.
+func (p shortcodeParam) Get(name string) string {
+	return p.Args[name]
+}
+
+type shortcodeTag struct {
+	start, end int
+	name       string
+	args       map[string]string
+	closing    bool
+	selfClosed bool
+	// {{</* ... */>}}, which stands for itself.
+	literal bool
+	// The index of the matching closing tag of an opening tag, or -1.
+	closedBy int
+}
+
+func parseShortcodeTags(body []byte) ([]shortcodeTag, error) {
+	matches := shortcodeTagRe.FindAllSubmatchIndex(body, -1)
+	tags := make([]shortcodeTag, 0, len(matches))
+	for _, m := range matches {
+		group := func(i int) []byte {
+			if m[2*i] < 0 {
+				return nil
+			}
+			return body[m[2*i]:m[2*i+1]]
+		}
+		tag := shortcodeTag{
+			start:      m[0],
+			end:        m[1],
+			literal:    len(group(1)) > 0 && len(group(6)) > 0,
+			closing:    len(group(2)) > 0,
+			name:       string(group(3)),
+			selfClosed: len(group(5)) > 0,
+			args:       make(map[string]string),
+			closedBy:   -1,
+		}
+		for _, arg := range shortcodeArgRe.FindAllSubmatch(group(4), -1) {
+			val := string(arg[2])
+			if strings.HasPrefix(val, `"`) {
+				var err error
+				if val, err = strconv.Unquote(val); err != nil {
+					return nil, &shortcodeError{tag.start, fmt.Errorf("invalid argument %s of shortcode %q: %v", arg[1], tag.name, err)}
+				}
+			}
+			tag.args[string(arg[1])] = val
+		}
+		tags = append(tags, tag)
+	}
+	matchShortcodeTags(tags)
+	return tags, nil
+}
+
+// Set closedBy of the opening tags that have a closing tag. A closing tag
+// belongs to the innermost open shortcode of the same name; the shortcodes
+// opened after that one are left without inner content.
+func matchShortcodeTags(tags []shortcodeTag) {
+	var open []int
+	for i, tag := range tags {
+		switch {
+		case tag.literal || tag.selfClosed:
+		case tag.closing:
+			for len(open) > 0 {
+				j := open[len(open)-1]
+				open = open[:len(open)-1]
+				if tags[j].name == tag.name {
+					tags[j].closedBy = i
+					break
+				}
+			}
+		default:
+			open = append(open, i)
+		}
+	}
+}
+
+// The line number of the byte at pos, starting at 1.
+func lineAt(text []byte, pos int) int {
+	return bytes.Count(text[:pos], []byte("\n")) + 1
+}
+
+// Replace the shortcodes in the body of p by the output of their templates.
+// A shortcode has inner content if there is a matching closing tag.
+func (te *templateEngine) resolveShortcodes(body []byte, p *post) ([]byte, error) {
+	tags, err := parseShortcodeTags(body)
+	if err == nil && len(tags) == 0 {
+		return body, nil
+	}
+
+	var out []byte
+	if err == nil {
+		out, err = te.expandShortcodes(body, 0, len(body), tags, 0, len(tags), p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("post %v, line %d: %v", p.ID, p.bodyLine+lineAt(body, errorPos(err))-1, err)
+	}
+	return out, nil
+}
+
+// An error in the shortcode at a position in the body.
+type shortcodeError struct {
+	pos int
+	err error
+}
+
+func (e *shortcodeError) Error() string { return e.err.Error() }
+
+func errorPos(err error) int {
+	var scErr *shortcodeError
+	if errors.As(err, &scErr) {
+		return scErr.pos
+	}
+	return 0
+}
+
+// Expand the shortcodes in body[from:to], whose tags are tags[i:j]. Each tag
+// is expanded once.
+func (te *templateEngine) expandShortcodes(body []byte, from, to int, tags []shortcodeTag, i, j int, p *post) ([]byte, error) {
+	var out bytes.Buffer
+	pos := from
+	for ; i < j; i++ {
+		tag := tags[i]
+		out.Write(body[pos:tag.start])
+		pos = tag.end
+
+		switch {
+		case tag.literal:
+			out.WriteString(literalShortcode(body[tag.start:tag.end]))
+			continue
+		case tag.closing:
+			// Closing tags with an opening one are skipped below.
+			return nil, &shortcodeError{tag.start, fmt.Errorf("closing shortcode %q was never opened", tag.name)}
+		}
+
+		param := shortcodeParam{Name: tag.name, Args: tag.args, Post: p}
+		if c := tag.closedBy; c >= 0 {
+			inner, err := te.expandShortcodes(body, tag.end, tags[c].start, tags, i+1, c, p)
+			if err != nil {
+				return nil, err
+			}
+			param.Inner = template.HTML(inner)
+			pos, i = tags[c].end, c
+		}
+
+		if err := te.renderShortcode(&out, param); err != nil {
+			return nil, &shortcodeError{tag.start, err}
+		}
+	}
+	out.Write(body[pos:to])
+	return out.Bytes(), nil
+}
+
+// The text of a {{</* ... */>}} tag without the comment markers.
+func literalShortcode(tag []byte) string {
+	s := string(tag)
+	s = strings.Replace(s, "/*", "", 1)
+	if i := strings.LastIndex(s, "*/"); i >= 0 {
+		s = s[:i] + s[i+2:]
+	}
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(s, "{{<"), ">}}"))
+	return "{{< " + s + " >}}"
+}
+
+func (te *templateEngine) renderShortcode(out *bytes.Buffer, p shortcodeParam) error {
+	t, err := te.getShortcodeTemplate(p.Name)
+	if err != nil {
+		return err
+	}
+	return t.Execute(out, p)
+}
+
+func (te *templateEngine) getShortcodeTemplate(name string) (*template.Template, error) {
+	cacheKey := shortcodesDir + "/" + name
+	if t, ok := te.templateCache[cacheKey]; ok {
+		return t, nil
+	}
+	t, err := te.parseTemplateFiles(cacheKey + ".html")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("unknown shortcode %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	te.templateCache[cacheKey] = t
+	return t, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A template engine with the built-in theme and a box shortcode that wraps
+// its inner content.
+func newShortcodeTestEngine(t *testing.T) templateEngine {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, shortcodesDir), 0o775); err != nil {
+		t.Fatal(err)
+	}
+	box := `<div class="box">{{.Inner}}</div>`
+	if err := os.WriteFile(filepath.Join(dir, shortcodesDir, "box.html"), []byte(box), 0o664); err != nil {
+		t.Fatal(err)
+	}
+	return newTemplateEngine(nil, &SiteConf{BaseURL: "https://example.com/", TemplateDir: dir})
+}
+
+func TestResolveShortcodes(t *testing.T) {
+	te := newShortcodeTestEngine(t)
+	tests := []struct {
+		body, want string
+	}{
+		{`a {{< box >}}in{{< /box >}} b`, `a <div class="box">in</div> b`},
+		{`{{< box >}}1{{< box >}}2{{< /box >}}3{{< /box >}}`, `<div class="box">1<div class="box">2</div>3</div>`},
+		{`{{< box >}}1{{< figure src="x.png" >}}2{{< /box >}}`, "<div class=\"box\">1\n\n<figure><img src=\"x.png\" alt=\"\" /></figure>\n\n2</div>"},
+		{`{{< box />}} x`, `<div class="box"></div> x`},
+		{`{{</* box */>}}`, `{{< box >}}`},
+	}
+	for _, test := range tests {
+		got, err := te.resolveShortcodes([]byte(test.body), &post{ID: "test"})
+		if err != nil {
+			t.Errorf("%q: %v", test.body, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%q: got %q, want %q", test.body, got, test.want)
+		}
+	}
+}
+
+func TestResolveShortcodesStrayClosingTag(t *testing.T) {
+	te := newShortcodeTestEngine(t)
+	_, err := te.resolveShortcodes([]byte("a\n{{< box >}}\n{{< /figure >}}"), &post{ID: "test", bodyLine: 1})
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("got error %v, want one about line 3", err)
+	}
+}
+
+// Figures are blocks of their own, not inside a paragraph, even if the
+// shortcode is.
+func TestFigureIsBlock(t *testing.T) {
+	conf := &SiteConf{BaseURL: "https://example.com/", TemplateDir: t.TempDir()}
+	renderers, err := newMarkdownRenderers(conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	te := newTemplateEngine(renderers, conf)
+	p := &post{ID: "test", Body: []byte(`Text {{< figure src="x.png" >}} more.` + "\n")}
+	for _, engine := range []string{blackfridayEngine, goldmarkEngine} {
+		rendered, err := te.renderBody(renderers[engine], p)
+		if err != nil {
+			t.Fatalf("%v: %v", engine, err)
+		}
+		got := strings.Join(strings.Fields(rendered.html), " ")
+		want := `<p>Text</p> <figure><img src="x.png" alt="" /></figure> <p>more.</p>`
+		if got != want {
+			t.Errorf("%v: got %v, want %v", engine, got, want)
+		}
+	}
+}
+
+// Shortcodes without closing tag used to be expanded again for each earlier
+// one, taking exponential time.
+func TestResolveManyUnclosedShortcodes(t *testing.T) {
+	te := newShortcodeTestEngine(t)
+	var body strings.Builder
+	for range 200 {
+		body.WriteString(`{{< figure src="x.png" caption="A figure" >}}` + "\n\n")
+	}
+
+	start := time.Now()
+	got, err := te.resolveShortcodes([]byte(body.String()), &post{ID: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(got), "<figure>"); n != 200 {
+		t.Errorf("got %d figures, want 200", n)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %v", d)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type SiteConf struct {
@@ -12,6 +13,10 @@ type SiteConf struct {
 	BaseURL           string
 	SiteTitle         string
 
+	// The authors that posts can name in their author header, by the name
+	// used there.
+	Authors map[string]AuthorConf
+
 	TemplateDir string
 
 	WritingDir                 string
@@ -19,13 +24,77 @@ type SiteConf struct {
 	WritingFileDateStampFormat string
 	StaticFilesDir             string
 
-	OutDir           string
+	OutDir string
+	// Relative to OutDir. Only used for the default categories taxonomy
+	// when Taxonomies is empty.
 	CategoriesOutDir string
+	// Relative to OutDir.
+	AuthorsOutDir string
+	SeriesOutDir  string
+
+	Taxonomies []TaxonomyConf
+
+	// The feeds to write for the site, each taxonomy term, and each author:
+	// "atom" as <name>.xml, "rss" for RSS 2.0 as <name>.rss, and "json" for
+	// JSON Feed as <name>.json, but feed.json for the site. Defaults to Atom
+	// only.
+	FeedFormats []string
+	// Feeds and their entries have tag URIs (RFC 4151) as permanent ids, so
+	// that they stay the same when BaseURL changes. TagAuthority is a domain
+	// or email address you own, and TagDate, as YYYY-MM-DD, a date you owned
+	// it on, such as that of your first post. Without them, ids are derived
+	// from URLs as in earlier versions, and change with BaseURL. Once feeds
+	// are published, don't change either.
+	TagAuthority string
+	TagDate      string
+	// What feed entries contain: "full", the default, for the whole post,
+	// "summary" for the blurb or else the first paragraph, or "paragraphs"
+	// for the first FeedParagraphs paragraphs, 3 by default, and a link to
+	// the rest.
+	FeedContent    string
+	FeedParagraphs int
+	// If set, feeds have only the latest this many posts.
+	MaxFeedEntries int
+
+	MaxArticlesOnIndex int
+	// If set, the index and category pages are split into pages of this
+	// many posts instead of truncating the index to MaxArticlesOnIndex.
+	PostsPerPage int
 
-	MaxArticlesOnIndex                  int
 	NumFrequentCategories               int
 	MinArticlesForFrequentCategories    int
 	MaxAgeForFrequentCategoriesInMonths int
+
+	// The Markdown engine for posts that don't choose one in their markdown
+	// header: "blackfriday", the default, or "goldmark". MarkdownExtensions
+	// lists the extensions to use instead of an engine's defaults, by engine.
+	MarkdownEngine     string
+	MarkdownExtensions map[string][]string
+
+	// How footnotes are shown: "endnotes", the default, or "sidenotes".
+	// Posts can choose with a flag of the same name.
+	FootnoteStyle string
+
+	// Render $...$ and $$...$$ math in all posts to MathML, not only in posts
+	// with the math flag. MathMacros defines TeX macros for all math, by
+	// name without the backslash.
+	Math       bool
+	MathMacros map[string]string
+
+	// The chroma style for syntax highlighting of code blocks, "github" by
+	// default. Highlighted code uses CSS classes, unless
+	// HighlightInlineStyles is set. The build then writes the matching
+	// stylesheet to highlight.css in OutDir, as does the highlight-css
+	// command.
+	HighlightStyle        string
+	HighlightInlineStyles bool
+
+	// How many related posts to show with each post. Defaults to 5, a
+	// negative number turns related posts off.
+	NumRelatedPosts int
+	// How much shared categories and similar content, respectively, count
+	// towards how related two posts are. Both default to 1.
+	RelatedCategoriesWeight, RelatedContentWeight float64
 }
 
 func readConf(fileName string) *SiteConf {
@@ -49,6 +118,64 @@ func readConf(fileName string) *SiteConf {
 	if len(conf.CategoriesOutDir) == 0 {
 		conf.CategoriesOutDir = "categories"
 	}
+	if len(conf.AuthorsOutDir) == 0 {
+		conf.AuthorsOutDir = "authors"
+	}
+	if len(conf.SeriesOutDir) == 0 {
+		conf.SeriesOutDir = "series"
+	}
+	if len(conf.Taxonomies) == 0 {
+		conf.Taxonomies = []TaxonomyConf{defaultTaxonomy(conf.CategoriesOutDir)}
+	}
+	for i := range conf.Taxonomies {
+		if len(conf.Taxonomies[i].Name) == 0 {
+			log.Fatalf("Taxonomy %d has no Name", i+1)
+		}
+		conf.Taxonomies[i].populateDefaults()
+	}
+	if len(conf.FeedFormats) == 0 {
+		conf.FeedFormats = []string{atomFormat}
+	}
+	for _, format := range conf.FeedFormats {
+		if _, ok := feedExtensions[format]; !ok {
+			log.Fatalf("Unknown feed format %q", format)
+		}
+	}
+	if len(conf.TagDate) > 0 {
+		if _, err := time.Parse(time.DateOnly, conf.TagDate); err != nil {
+			log.Fatalf("Invalid TagDate %q, the format is YYYY-MM-DD", conf.TagDate)
+		}
+	}
+	switch conf.FeedContent {
+	case "":
+		conf.FeedContent = feedContentFull
+	case feedContentFull, feedContentSummary, feedContentParagraphs:
+	default:
+		log.Fatalf("Unknown FeedContent %q", conf.FeedContent)
+	}
+	if conf.FeedParagraphs <= 0 {
+		conf.FeedParagraphs = 3
+	}
+	if len(conf.MarkdownEngine) == 0 {
+		conf.MarkdownEngine = blackfridayEngine
+	}
+	switch conf.FootnoteStyle {
+	case "":
+		conf.FootnoteStyle = endnotesStyle
+	case endnotesStyle, sidenotesStyle:
+	default:
+		log.Fatalf("Unknown FootnoteStyle %q", conf.FootnoteStyle)
+	}
+	if len(conf.HighlightStyle) == 0 {
+		conf.HighlightStyle = "github"
+	}
+	if conf.NumRelatedPosts == 0 {
+		conf.NumRelatedPosts = 5
+	}
+	if conf.RelatedCategoriesWeight == 0 && conf.RelatedContentWeight == 0 {
+		conf.RelatedCategoriesWeight = 1
+		conf.RelatedContentWeight = 1
+	}
 
 	// Normalize relative paths because the executable can be called from anywhere
 	baseDir := filepath.Dir(fileName)
@@ -57,8 +184,6 @@ func readConf(fileName string) *SiteConf {
 	conf.StaticFilesDir = normalizePath(conf.StaticFilesDir, baseDir)
 	conf.OutDir = normalizePath(conf.OutDir, baseDir)
 
-	conf.CategoriesOutDir = normalizePath(conf.CategoriesOutDir, conf.OutDir)
-
 	conf.TemplateDir, err = filepath.Abs(conf.TemplateDir)
 	if err != nil {
 		log.Fatal(err)
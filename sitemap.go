@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// See https://www.sitemaps.org/protocol.html.
+
+const sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// The most URLs a sitemap may have. Bigger sitemaps are split into several
+// files listed in a sitemap index.
+const maxSitemapURLs = 50000
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	NS      string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	NS       string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+func sitemapDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// The date of the latest change to any of ps.
+func lastModified(ps posts) time.Time {
+	var t time.Time
+	for _, p := range ps {
+		if p.LastModified().After(t) {
+			t = p.LastModified()
+		}
+	}
+	return t
+}
+
+// The URLs of the index, all posts and static pages, and the pages of all
+// taxonomies.
+func (s *Site) sitemapURLs() []sitemapURL {
+	indexable := make(posts, 0, len(s.posts))
+	for _, p := range s.posts {
+		if p.IsIndexable() {
+			indexable = append(indexable, p)
+		}
+	}
+
+	urls := []sitemapURL{{Loc: s.conf.BaseURL, LastMod: sitemapDate(lastModified(indexable))}}
+	for _, p := range indexable {
+		urls = append(urls, sitemapURL{
+			Loc:     s.conf.BaseURL + p.ID + ".html",
+			LastMod: sitemapDate(p.LastModified()),
+		})
+	}
+	for i := range s.conf.Taxonomies {
+		t := &s.conf.Taxonomies[i]
+		byTerm := groupByTerm(indexable, t.Name)
+		if len(byTerm) == 0 {
+			continue
+		}
+		var taxonomyPosts posts
+		for _, c := range byTerm {
+			urls = append(urls, sitemapURL{
+				Loc:     s.conf.BaseURL + t.termPath(c.Category) + ".html",
+				LastMod: sitemapDate(lastModified(c.Posts)),
+			})
+			taxonomyPosts = append(taxonomyPosts, c.Posts...)
+		}
+		urls = append(urls, sitemapURL{
+			Loc:     s.conf.BaseURL + t.OverviewId + ".html",
+			LastMod: sitemapDate(lastModified(taxonomyPosts)),
+		})
+	}
+	return urls
+}
+
+// Write sitemap.xml and a robots.txt that points to it. With more than
+// maxSitemapURLs URLs, sitemap.xml is an index of sitemap-<n>.xml files.
+func (s *Site) RenderSitemap() error {
+	urls := s.sitemapURLs()
+
+	if len(urls) <= maxSitemapURLs {
+		if err := writeSitemapXML(filepath.Join(s.conf.OutDir, "sitemap.xml"), sitemapURLSet{NS: sitemapNS, URLs: urls}); err != nil {
+			return err
+		}
+	} else {
+		index := sitemapIndex{NS: sitemapNS}
+		for n := 1; len(urls) > 0; n++ {
+			part := urls[:min(len(urls), maxSitemapURLs)]
+			urls = urls[len(part):]
+
+			name := fmt.Sprintf("sitemap-%d.xml", n)
+			if err := writeSitemapXML(filepath.Join(s.conf.OutDir, name), sitemapURLSet{NS: sitemapNS, URLs: part}); err != nil {
+				return err
+			}
+			var lastMod string
+			for _, u := range part {
+				// Dates in UTC compare like the times.
+				lastMod = max(lastMod, u.LastMod)
+			}
+			index.Sitemaps = append(index.Sitemaps, sitemapURL{Loc: s.conf.BaseURL + name, LastMod: lastMod})
+		}
+		if err := writeSitemapXML(filepath.Join(s.conf.OutDir, "sitemap.xml"), index); err != nil {
+			return err
+		}
+	}
+
+	robots := "User-agent: *\nAllow: /\n\nSitemap: " + s.conf.BaseURL + "sitemap.xml\n"
+	return os.WriteFile(filepath.Join(s.conf.OutDir, "robots.txt"), []byte(robots), 0o664)
+}
+
+func writeSitemapXML(path string, v any) error {
+	data, err := xml.MarshalIndent(v, "", " ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+	return os.WriteFile(path, append(data, '\n'), 0o664)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A way to classify posts, such as categories or tags. Posts list their
+// terms of the taxonomy in the header field HeaderKey. Each term gets a
+// paginated list page and a feed in OutDir, and there is an overview page of
+// all terms.
+type TaxonomyConf struct {
+	// Identifies the taxonomy, e.g. "tags".
+	Name string
+	// Defaults to Name.
+	HeaderKey string
+	// Used in feed titles, e.g. "Tag". Defaults to Name.
+	Singular string
+	// Relative to OutDir. Defaults to Name.
+	OutDir string
+	// File id of the overview page of all terms. Defaults to Name.
+	OverviewId    string
+	OverviewTitle string
+}
+
+// The taxonomy used when SiteConf.Taxonomies is empty, which is how blog11
+// worked before it had taxonomies.
+func defaultTaxonomy(categoriesOutDir string) TaxonomyConf {
+	return TaxonomyConf{
+		Name:          "categories",
+		Singular:      "Category",
+		OutDir:        categoriesOutDir,
+		OverviewId:    "topics",
+		OverviewTitle: "Topics",
+	}
+}
+
+func (t *TaxonomyConf) populateDefaults() {
+	if len(t.HeaderKey) == 0 {
+		t.HeaderKey = t.Name
+	}
+	if len(t.Singular) == 0 {
+		t.Singular = t.Name
+	}
+	if len(t.OutDir) == 0 {
+		t.OutDir = t.Name
+	}
+	if len(t.OverviewId) == 0 {
+		t.OverviewId = t.Name
+	}
+	if len(t.OverviewTitle) == 0 {
+		t.OverviewTitle = t.Name
+	}
+}
+
+// The slash-separated path of a term's list page relative to OutDir, without
+// the .html extension. Also the directory of the further pages of the list.
+func (t *TaxonomyConf) termPath(term category) string {
+	return t.OutDir + "/" + term.Id()
+}
+
+func (conf *SiteConf) taxonomy(name string) *TaxonomyConf {
+	for i := range conf.Taxonomies {
+		if conf.Taxonomies[i].Name == name {
+			return &conf.Taxonomies[i]
+		}
+	}
+	return nil
+}
+
+func (conf *SiteConf) taxonomyForHeader(key string) *TaxonomyConf {
+	for i := range conf.Taxonomies {
+		if conf.Taxonomies[i].HeaderKey == key {
+			return &conf.Taxonomies[i]
+		}
+	}
+	return nil
+}
+
+// Render the list pages of all terms of taxonomy t and its overview page.
+func (s *Site) renderTaxonomyPages(t *TaxonomyConf, tp templateParam, engine templateEngine) error {
+	byTerm := groupByTerm(s.posts, t.Name)
+
+	if err := os.MkdirAll(filepath.Join(s.conf.OutDir, t.OutDir), 0o775); err != nil {
+		return err
+	}
+
+	for _, c := range byTerm {
+		termId := c.Category.Id()
+		tp.PageTitle = c.Category.String()
+		tp.FeedId = termId
+		tp.Feeds = s.feedLinks(t.termPath(c.Category))
+		tp.FileId = termId
+		p := postListTemplateParam{templateParam: tp, PageHeading: c.Category.String()}
+		termPath := t.termPath(c.Category)
+		if err := s.renderPaginatedPostsList(c.Posts, termPath+".html", termPath, p, engine); err != nil {
+			return err
+		}
+	}
+
+	// Render the overview page.
+	var b bytes.Buffer
+	tp.PageTitle = t.OverviewTitle
+	tp.FeedId = "index"
+	tp.Feeds = s.feedLinks("index")
+	tp.FileId = t.OverviewId
+	if err := engine.renderTopics(tp, t, byTerm, &b); err != nil {
+		return err
+	}
+	outHtmlName := filepath.Join(s.conf.OutDir, tp.FileId+".html")
+	return os.WriteFile(outHtmlName, b.Bytes(), 0o664)
+}
+
+// s with its first letter in upper case.
+func capitalize(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+func (s *Site) renderAndSaveTaxonomyFeeds() error {
+	for i := range s.conf.Taxonomies {
+		t := &s.conf.Taxonomies[i]
+		singular := capitalize(t.Singular)
+		for _, termArticles := range groupByTerm(s.posts, t.Name) {
+			term := termArticles.Category
+			title := s.conf.SiteTitle + ` ` + singular + ` "` + term.String() + `."`
+			urlPath := t.termPath(term) + ".html"
+			basePath := filepath.Join(s.conf.OutDir, filepath.FromSlash(t.termPath(term)))
+
+			err := s.renderAndSaveFeed(title, urlPath, basePath, s.siteAuthors(), termArticles.Posts)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// The built-in theme. Templates in TemplateDir override its files one by
+// one.
+//
+//go:embed theme
+var builtinTheme embed.FS
+
+const builtinThemeDir = "theme"
+
+// Read the template file name, a slash-separated path relative to
+// TemplateDir, from TemplateDir or else from the built-in theme.
+func (te *templateEngine) readTemplateFile(name string) ([]byte, error) {
+	text, err := os.ReadFile(filepath.Join(te.templateDir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return builtinTheme.ReadFile(path.Join(builtinThemeDir, name))
+	}
+	return text, err
+}
+
+// Whether the template file name exists in TemplateDir or the built-in theme.
+func (te *templateEngine) templateExists(name string) bool {
+	if _, err := os.Stat(filepath.Join(te.templateDir, filepath.FromSlash(name))); err == nil {
+		return true
+	}
+	_, err := fs.Stat(builtinTheme, path.Join(builtinThemeDir, name))
+	return err == nil
+}
+
+// Parse the template files like template.ParseFiles, but with
+// readTemplateFile and the functions of newTemplateFuncs. The result is the
+// template of the first file.
+func (te *templateEngine) parseTemplateFiles(names ...string) (*template.Template, error) {
+	var t *template.Template
+	for _, name := range names {
+		text, err := te.readTemplateFile(name)
+		if err != nil {
+			return nil, err
+		}
+		// Named by the path relative to TemplateDir, for error messages.
+		var tmpl *template.Template
+		if t == nil {
+			t = template.New(name).Funcs(te.funcs)
+			tmpl = t
+		} else {
+			tmpl = t.New(name)
+		}
+		if _, err := tmpl.Parse(string(text)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Copy the built-in theme to dir for customization. Files that already exist
+// in dir are left alone.
+func exportTheme(dir string) error {
+	themeFS, err := fs.Sub(builtinTheme, builtinThemeDir)
+	if err != nil {
+		return err
+	}
+	return fs.WalkDir(themeFS, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(name))
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0o775)
+		}
+		if _, err := os.Stat(dest); err == nil {
+			log.Println("Not overwriting", dest)
+			return nil
+		}
+		content, err := fs.ReadFile(themeFS, name)
+		if err != nil {
+			return err
+		}
+		log.Println("Writing", dest)
+		return os.WriteFile(dest, content, 0o664)
+	})
+}
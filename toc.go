@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A heading in a post's table of contents, with the headings below it.
+type TocEntry struct {
+	// 1 for <h1> and so on.
+	Level int
+	// The id of the heading element, to link to it as "#" + ID.
+	ID string
+	// The text of the heading, with math as its TeX source, and as HTML,
+	// with math as MathML.
+	Title     string
+	TitleHTML template.HTML
+	Children  []TocEntry
+}
+
+// Turn a heading into an id: lowercase letters and digits, with runs of
+// anything else replaced by a single dash.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// The heading ids used so far in a post, to keep them unique.
+type headingIDs map[string]bool
+
+// Reserve id, or if it's taken, id with the first free "-<n>" suffix.
+func (ids headingIDs) add(id string) string {
+	unique := id
+	for n := 1; ids[unique]; n++ {
+		unique = id + "-" + strconv.Itoa(n)
+	}
+	ids[unique] = true
+	return unique
+}
+
+// Reserve id, which the author gave a heading. It's kept even if it's taken,
+// so that links to it keep working. Returns false if it was taken.
+func (ids headingIDs) addExplicit(id string) bool {
+	if ids[id] {
+		return false
+	}
+	ids[id] = true
+	return true
+}
+
+// Reserve a unique id for a heading with the given text. Math in the
+// heading is left out.
+func (ids headingIDs) forHeading(text string) string {
+	slug := slugify(mathPlaceholderRe.ReplaceAllString(text, ""))
+	if len(slug) == 0 {
+		slug = "section"
+	}
+	return ids.add(slug)
+}
+
+// Nest the headings of a post, in document order and without children, into
+// a tree. Each heading gets the following deeper headings as children.
+func buildToc(headings []TocEntry) []TocEntry {
+	entries := make([]TocEntry, 0, len(headings))
+	for i := 0; i < len(headings); {
+		e := headings[i]
+		j := i + 1
+		for j < len(headings) && headings[j].Level > e.Level {
+			j++
+		}
+		e.Children = buildToc(headings[i+1 : j])
+		entries = append(entries, e)
+		i = j
+	}
+	return entries
+}
+
+// Set the TitleHTML of each entry, and put the math, rendered as MathML and
+// as TeX respectively, into TitleHTML and Title.
+func finishToc(toc []TocEntry, mathML, tex []string) {
+	for i := range toc {
+		e := &toc[i]
+		e.TitleHTML = template.HTML(replaceMathPlaceholders(html.EscapeString(e.Title), mathML))
+		e.Title = replaceMathPlaceholders(e.Title, tex)
+		finishToc(e.Children, mathML, tex)
+	}
+}
+
+// The ToC as nested lists in a <nav>, for the toc flag. Empty if there are
+// no headings.
+func tocHTML(toc []TocEntry) string {
+	if len(toc) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<nav>\n")
+	writeTocList(&b, toc)
+	b.WriteString("</nav>\n\n")
+	return b.String()
+}
+
+func writeTocList(b *strings.Builder, entries []TocEntry) {
+	b.WriteString("<ul>\n")
+	for _, e := range entries {
+		fmt.Fprintf(b, `<li><a href="#%s">%s</a>`, html.EscapeString(e.ID), e.TitleHTML)
+		if len(e.Children) > 0 {
+			b.WriteString("\n")
+			writeTocList(b, e.Children)
+		}
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</ul>\n")
+}
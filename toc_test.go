@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func tocIDs(toc []TocEntry) []string {
+	var ids []string
+	for _, e := range toc {
+		ids = append(ids, e.ID)
+		ids = append(ids, tocIDs(e.Children)...)
+	}
+	return ids
+}
+
+func TestHeadingIDs(t *testing.T) {
+	conf := &SiteConf{MarkdownExtensions: map[string][]string{blackfridayEngine: {"headingIDs"}}}
+	renderers, err := newMarkdownRenderers(conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		engine, body string
+		ids          []string
+		duplicates   []string
+	}{
+		{goldmarkEngine, "# Intro\n\n# Intro\n\n# Other\n", []string{"intro", "intro-1", "other"}, nil},
+		{blackfridayEngine, "# Intro\n\n# Intro\n\n# Other\n", []string{"intro", "intro-1", "other"}, nil},
+		// Ids given by the author are kept, generated ones make way.
+		{blackfridayEngine, "# Intro\n\n# Other {#intro}\n\n# Intro\n", []string{"intro-1", "intro", "intro-2"}, nil},
+		{blackfridayEngine, "# A {#x}\n\n# B {#x}\n", []string{"x", "x"}, []string{"x"}},
+	}
+	for _, test := range tests {
+		rendered, err := renderers[test.engine].render([]byte(test.body))
+		if err != nil {
+			t.Fatalf("%v %q: %v", test.engine, test.body, err)
+		}
+		if got := tocIDs(rendered.toc); strings.Join(got, " ") != strings.Join(test.ids, " ") {
+			t.Errorf("%v %q: got ids %v, want %v", test.engine, test.body, got, test.ids)
+		}
+		if strings.Join(rendered.duplicateIDs, " ") != strings.Join(test.duplicates, " ") {
+			t.Errorf("%v %q: got duplicate ids %v, want %v", test.engine, test.body, rendered.duplicateIDs, test.duplicates)
+		}
+		for _, id := range test.ids {
+			if !strings.Contains(rendered.html, `id="`+id+`"`) {
+				t.Errorf("%v %q: no heading with id %v in %v", test.engine, test.body, id, rendered.html)
+			}
+		}
+	}
+}